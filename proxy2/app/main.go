@@ -2,13 +2,31 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
+	"http-proxy/config"
 	"http-proxy/pkg/api"
+	"http-proxy/pkg/ca"
+	"http-proxy/pkg/cmdi"
+	"http-proxy/pkg/crlf"
+	"http-proxy/pkg/importer"
+	"http-proxy/pkg/oob"
 	"http-proxy/pkg/proxy"
+	"http-proxy/pkg/redirect"
+	"http-proxy/pkg/scanner"
+	"http-proxy/pkg/sqli"
+	"http-proxy/pkg/ssti"
+	"http-proxy/pkg/traversal"
+	"http-proxy/pkg/xss"
+	"http-proxy/pkg/xxe"
 	"http-proxy/repo"
 	"http-proxy/server"
 
@@ -17,52 +35,212 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func mongoConnect(username, password, host string, port int) (*mongo.Client, error) {
+func mongoConnect(uri string) (*mongo.Client, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	connectionString := fmt.Sprintf("mongodb://%s:%s@%s:%d", username, password, host, port)
-	return mongo.Connect(ctx, options.Client().ApplyURI(connectionString))
+	return mongo.Connect(ctx, options.Client().ApplyURI(uri))
+}
+
+func openStorage(cfg config.StorageConfig) (repo.RequestSaver, repo.ResponseSaver, error) {
+	switch cfg.Backend {
+	case "mongo":
+		mongoConn, err := mongoConnect(cfg.MongoURI)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		blobs, err := repo.NewGridFSBlobStore(mongoConn)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		responses, err := repo.NewMongoResponseSaver(mongoConn, blobs)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return repo.NewMongoRequestSaver(mongoConn, blobs), responses, nil
+
+	case "bolt":
+		blobs, err := repo.NewFileBlobStore(filepath.Join(cfg.Path, "bodies"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		db, err := repo.OpenBolt(filepath.Join(cfg.Path, "proxy.db"))
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return repo.NewBoltRequestSaver(db, blobs), repo.NewBoltResponseSaver(db, blobs), nil
+
+	case "memory":
+		blobs := repo.NewMemoryBlobStore()
+		return repo.NewMemoryRequestSaver(blobs), repo.NewMemoryResponseSaver(blobs), nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown storage backend %q", cfg.Backend)
 }
 
 func main() {
-	mongoConn, err := mongoConnect("root", "example", "mongo", 27017)
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		runImport(os.Args[2:])
+		return
+	}
+
+	cfg, err := config.Load(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	requests := repo.NewMongoRequestSaver(mongoConn)
-	responses := repo.NewMongoResponseSaver(mongoConn)
+	requests, responses, err := openStorage(cfg.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	handler, err := proxy.NewHandler(requests, responses)
+	certStore, err := ca.NewDirStore(cfg.CA.CertsDir)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	go startHttpApi(requests, responses)
+	authority, err := ca.LoadOrCreate(cfg.CA.Cert, cfg.CA.Key, certStore)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	handler, err := proxy.NewHandler(authority, requests, responses, proxy.Options{
+		BodyLimit:        cfg.Limits.Body,
+		UpstreamTimeout:  cfg.Timeouts.Upstream,
+		KeepAliveTimeout: cfg.Timeouts.KeepAlive,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	checks := scanner.NewRegistry(
+		xxe.NewCheck(),
+		sqli.NewCheck(),
+		xss.NewCheck(),
+		cmdi.NewCheck(),
+		traversal.NewCheck(),
+		ssti.NewCheck(),
+		redirect.NewCheck(),
+		crlf.NewCheck(),
+	)
+	if err := checks.Enable(cfg.Scan.Checks); err != nil {
+		log.Fatal(err)
+	}
+
+	var interactions *oob.Server
+	if cfg.OOB.Enabled {
+		interactions = oob.NewServer(oob.Options{
+			HTTPAddr: cfg.OOB.HTTPAddr,
+			DNSAddr:  cfg.OOB.DNSAddr,
+			Domain:   cfg.OOB.Domain,
+			Host:     cfg.OOB.Host,
+			Wait:     cfg.OOB.Wait,
+		})
+		if err := interactions.Start(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	go startHttpApi(cfg, requests, responses, checks, interactions)
 
-	server.Run(8080, handler.Handle)
+	server.Run(cfg.ProxyAddr, handler.Handle)
 }
 
-func startHttpApi(req repo.RequestSaver, resp repo.ResponseSaver) {
-	router := mux.NewRouter()
+// runImport stores HAR and Burp XML files given after the flags, e.g.
+// "http-proxy import -storage bolt session.har".
+func runImport(args []string) {
+	cfg, err := config.Load(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	handler, err := api.NewHandler(req, resp)
+	if len(cfg.Args) == 0 {
+		log.Fatal("no files to import")
+	}
+	if cfg.Storage.Backend == "memory" {
+		log.Fatal("the memory backend does not keep imported records")
+	}
+
+	requests, responses, err := openStorage(cfg.Storage)
 	if err != nil {
 		log.Fatal(err)
 	}
 
+	for _, path := range cfg.Args {
+		results, err := importFile(path, requests, responses, cfg.Limits.Body)
+		if err != nil {
+			log.Fatalf("%s: %v", path, err)
+		}
+		log.Printf("%s: imported %d requests", path, len(results))
+	}
+}
+
+func importFile(path string, requests repo.RequestSaver, responses repo.ResponseSaver, bodyLimit int64) ([]importer.Result, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	format := ""
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".har":
+		format = importer.FormatHAR
+	case ".xml":
+		format = importer.FormatBurp
+	}
+
+	return importer.Import(file, format, requests, responses, repo.WithBodyLimit(bodyLimit))
+}
+
+func startHttpApi(cfg *config.Config, req repo.RequestSaver, resp repo.ResponseSaver, checks *scanner.Registry, interactions *oob.Server) {
+	router := mux.NewRouter()
+
+	handler := api.NewHandler(req, resp, api.Options{
+		Timeout:         cfg.Timeouts.API,
+		UpstreamTimeout: cfg.Timeouts.Upstream,
+		BodyLimit:       cfg.Limits.Body,
+		ListSize:        cfg.Limits.ListSize,
+		MaxListSize:     cfg.Limits.MaxListSize,
+		Checks:          checks,
+		ScanTimeout:     cfg.Scan.Timeout,
+		ScanMaxRequests: cfg.Scan.MaxRequests,
+		OOB:             interactions,
+	})
+
 	router.HandleFunc("/requests", handler.ListRequests)
 	router.HandleFunc("/requests/{id}", handler.GetRequest)
+	router.HandleFunc("/repeat/{id}", handler.EditAndRepeat).Methods(http.MethodPost)
 	router.HandleFunc("/repeat/{id}", handler.RepeatRequest)
 	router.HandleFunc("/scan/{id}", handler.ScanRequest)
 	router.HandleFunc("/requests/{id}/dump", handler.DumpRequest)
+	router.HandleFunc("/requests/{id}/raw", handler.GetRawRequest)
+	router.HandleFunc("/requests/{id}/derivatives", handler.ListDerivatives)
+	router.HandleFunc("/requests/{id}/insertion-points", handler.ListInsertionPoints)
 
 	router.HandleFunc("/responses", handler.ListResponses)
 	router.HandleFunc("/responses/{id}", handler.GetResponse)
+	router.HandleFunc("/responses/{id}/body", handler.GetResponseBody)
+	router.HandleFunc("/responses/{id}/raw", handler.GetRawResponse)
 	router.HandleFunc("/requests/{id}/response", handler.GetRequestResponse)
 
-	log.Println("Api listening at port 8000...")
+	router.HandleFunc("/oob/interactions", handler.ListInteractions)
+
+	router.HandleFunc("/export/har", handler.ExportHAR)
+	router.HandleFunc("/import", handler.Import).Methods(http.MethodPost)
+
+	log.Printf("Api listening at %s...", cfg.APIAddr)
 
-	http.ListenAndServe(":8000", router)
+	log.Fatal(http.ListenAndServe(cfg.APIAddr, router))
 }
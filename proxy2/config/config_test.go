@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOOBConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr string
+	}{
+		{name: "disabled by default"},
+		{name: "loopback listener", args: []string{"-oob"}, wantErr: "oob.host"},
+		{name: "wildcard listener", args: []string{"-oob", "-oob-http-addr", ":8081"}, wantErr: "oob.host"},
+		{name: "explicit host", args: []string{"-oob", "-oob-host", "10.0.0.5:8081"}},
+		{name: "reachable listener", args: []string{"-oob", "-oob-http-addr", "10.0.0.5:8081"}},
+		{name: "dns only", args: []string{"-oob", "-oob-http-addr", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := Load(tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.OOB.Enabled != (len(tt.args) != 0) {
+				t.Errorf("enabled = %v", cfg.OOB.Enabled)
+			}
+		})
+	}
+}
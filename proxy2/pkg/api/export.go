@@ -0,0 +1,91 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"http-proxy/pkg/har"
+	"http-proxy/pkg/http_utils"
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// exportPageSize is the number of requests read from the repository at once.
+const exportPageSize = 100
+
+// ExportHAR exports every request matching the list filters together with
+// its response. The status filter applies to the responses.
+func (h *Handler) ExportHAR(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
+	if err != nil {
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
+		return
+	}
+
+	// The first page is read before the export starts, so that failing
+	// storage is still reported with a status.
+	page := repo.Page{After: repo.Cursor(primitive.NilObjectID), Limit: exportPageSize}
+	entries, err := h.harEntries(filter, &page)
+	if err != nil {
+		utils.HTTPError(w, "Failed to export requests", http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="export.har"`)
+	encoder := har.NewEncoder(w)
+
+	for {
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return
+			}
+		}
+		if page.After == "" {
+			break
+		}
+
+		if entries, err = h.harEntries(filter, &page); err != nil {
+			// The status is sent already, aborting the response tells the
+			// client that the archive is incomplete.
+			panic(http.ErrAbortHandler)
+		}
+	}
+
+	encoder.Close()
+}
+
+// harEntries returns the exchanges of a page from the oldest to the newest
+// and moves the page on to newer requests, clearing it after the last page.
+func (h *Handler) harEntries(filter repo.Filter, page *repo.Page) ([]*har.Entry, error) {
+	requests, err := h.requests.List(filter, *page)
+	if err != nil {
+		return nil, err
+	}
+
+	// Pages read towards newer requests list the newest first.
+	page.After = ""
+	if int64(len(requests.Items)) == page.Limit {
+		page.After = repo.Cursor(requests.Items[0].ID)
+	}
+
+	entries := make([]*har.Entry, 0, len(requests.Items))
+	for i := len(requests.Items) - 1; i >= 0; i-- {
+		req := requests.Items[i]
+
+		resp, err := h.responses.GetByRequest(req.ID.Hex())
+		if errors.Is(err, repo.ErrNotFound) {
+			resp = nil
+		} else if err != nil {
+			return nil, err
+		}
+
+		if filter.Code != 0 && (resp == nil || resp.Code != filter.Code) {
+			continue
+		}
+		entries = append(entries, har.NewEntry(req, resp))
+	}
+
+	return entries, nil
+}
@@ -1,84 +1,56 @@
 package api
 
 import (
-	"crypto/tls"
-	"crypto/x509"
 	"encoding/json"
 	"errors"
-	"fmt"
 	"io"
 	"net/http"
 	"net/http/httputil"
-	"os"
-	"strconv"
 	"time"
 
 	"http-proxy/pkg/http_utils"
-	"http-proxy/pkg/xxe"
+	"http-proxy/pkg/oob"
+	"http-proxy/pkg/scanner"
 	"http-proxy/repo"
 
 	"github.com/gorilla/mux"
-)
-
-const (
-	defaultListSize     = 5
-	defaultTimeout      = 30 * time.Second
-	tlsHandshakeTimeout = 5 * time.Second
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Handler struct {
 	requests  repo.RequestSaver
 	responses repo.ResponseSaver
-	client    *http.Client
-}
-
-func NewHandler(req repo.RequestSaver, resp repo.ResponseSaver) (*Handler, error) {
-	transport, err := createSecureTransport()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create transport: %w", err)
-	}
-
+	options   Options
+}
+
+type Options struct {
+	// Timeout limits the whole exchange of requests sent by the API.
+	Timeout time.Duration
+	// UpstreamTimeout limits connecting to a server and every read and
+	// write on the connection.
+	UpstreamTimeout time.Duration
+	// BodyLimit is the number of body bytes stored inline in a record.
+	BodyLimit int64
+	// ListSize is the default number of items returned by list endpoints.
+	ListSize int64
+	// MaxListSize caps the page size clients may ask for.
+	MaxListSize int64
+	// Checks are the checks run by the scan endpoint.
+	Checks *scanner.Registry
+	// ScanTimeout limits a scan as a whole.
+	ScanTimeout time.Duration
+	// ScanMaxRequests limits the requests sent by a scan, 0 means no limit.
+	ScanMaxRequests int
+	// OOB records out-of-band interactions, nil if disabled.
+	OOB *oob.Server
+}
+
+func NewHandler(req repo.RequestSaver, resp repo.ResponseSaver, options Options) *Handler {
 	return &Handler{
 		requests:  req,
 		responses: resp,
-		client: &http.Client{
-			Transport:     transport,
-			Timeout:       defaultTimeout,
-			CheckRedirect: noRedirectPolicy,
-		},
-	}, nil
-}
-
-func noRedirectPolicy(req *http.Request, via []*http.Request) error {
-	return http.ErrUseLastResponse
-}
-
-func createSecureTransport() (*http.Transport, error) {
-	config, err := createTLSConfig()
-	if err != nil {
-		return nil, err
-	}
-
-	return &http.Transport{
-		TLSClientConfig:     config,
-		TLSHandshakeTimeout: tlsHandshakeTimeout,
-	}, nil
-}
-
-func createTLSConfig() (*tls.Config, error) {
-	cert, err := os.ReadFile("https/ca.crt")
-	if err != nil {
-		return nil, fmt.Errorf("failed to read CA certificate: %w", err)
-	}
-
-	pool := x509.NewCertPool()
-	if !pool.AppendCertsFromPEM(cert) {
-		return nil, errors.New("failed to append CA certificate")
+		options:   options,
 	}
-
-	return &tls.Config{
-		RootCAs: pool,
-	}, nil
 }
 
 func (h *Handler) GetRequest(w http.ResponseWriter, r *http.Request) {
@@ -95,61 +67,54 @@ func (h *Handler) GetRequest(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListRequests(w http.ResponseWriter, r *http.Request) {
-	limit, err := parseLimitParam(r)
+	filter, err := parseFilter(r)
 	if err != nil {
-		limit = defaultListSize
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
+		return
 	}
 
-	requests, err := h.requests.List(limit)
+	h.listRequests(w, r, filter)
+}
+
+// ListDerivatives lists the requests repeated or scanned from a request.
+func (h *Handler) ListDerivatives(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseFilter(r)
 	if err != nil {
-		utils.HTTPError(w, "Failed to list requests", http.StatusInternalServerError, err)
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
 		return
 	}
 
-	if err := encodeJSONResponse(w, requests); err != nil {
-		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	if filter.Parent, err = primitive.ObjectIDFromHex(mux.Vars(r)["id"]); err != nil {
+		utils.HTTPError(w, "Invalid request id", http.StatusBadRequest, err)
+		return
 	}
-}
 
-func parseLimitParam(r *http.Request) (int64, error) {
-	limitStr := r.URL.Query().Get("limit")
-	if limitStr == "" {
-		return defaultListSize, nil
-	}
-	return strconv.ParseInt(limitStr, 10, 64)
+	h.listRequests(w, r, filter)
 }
 
-func (h *Handler) RepeatRequest(w http.ResponseWriter, r *http.Request) {
-	requestID := mux.Vars(r)["id"]
-	req, err := h.requests.GetEncoded(requestID)
-	if err != nil {
-		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
+func (h *Handler) listRequests(w http.ResponseWriter, r *http.Request, filter repo.Filter) {
+	if err := requestFilter(filter); err != nil {
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
 		return
 	}
 
-	resp, err := h.client.Do(req)
-	if err != nil {
-		utils.HTTPError(w, "Failed to repeat request", http.StatusBadGateway, err)
+	requests, err := h.requests.List(filter, h.parsePage(r))
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		utils.HTTPError(w, "Invalid cursor", http.StatusBadRequest, err)
 		return
 	}
-	defer resp.Body.Close()
-
-	if err := forwardResponse(w, resp); err != nil {
-		utils.HTTPError(w, "Failed to forward response", http.StatusInternalServerError, err)
+	if errors.Is(err, repo.ErrScanLimit) {
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
+		return
 	}
-}
-
-func forwardResponse(w http.ResponseWriter, resp *http.Response) error {
-	for key, values := range resp.Header {
-		for _, value := range values {
-			w.Header().Add(key, value)
-		}
+	if err != nil {
+		utils.HTTPError(w, "Failed to list requests", http.StatusInternalServerError, err)
+		return
 	}
 
-	w.WriteHeader(resp.StatusCode)
-
-	_, err := io.Copy(w, resp.Body)
-	return err
+	if err := encodeJSONResponse(w, newListResponse(r, requests.Items, requests.Next)); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
 }
 
 func (h *Handler) DumpRequest(w http.ResponseWriter, r *http.Request) {
@@ -169,50 +134,44 @@ func (h *Handler) DumpRequest(w http.ResponseWriter, r *http.Request) {
 	w.Write(dump)
 }
 
-func (h *Handler) ScanRequest(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetRawRequest(w http.ResponseWriter, r *http.Request) {
 	requestID := mux.Vars(r)["id"]
-	req, err := h.requests.GetEncoded(requestID)
+	req, err := h.requests.Get(requestID)
 	if err != nil {
 		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
 		return
 	}
 
-	hadXML, err := xxe.AddVulnerability(req)
-	if err != nil {
-		utils.HTTPError(w, "Failed to modify request", http.StatusInternalServerError, err)
-		return
-	}
+	writeRaw(w, req.Raw, req.RawTruncated)
+}
 
-	if !hadXML {
-		w.Write([]byte("No XML content in request\n"))
+func writeRaw(w http.ResponseWriter, raw []byte, truncated bool) {
+	if len(raw) == 0 {
+		utils.HTTPError(w, "Failed to get raw message", http.StatusNotFound, errors.New("no raw capture"))
 		return
 	}
 
-	resp, err := h.client.Do(req)
-	if err != nil {
-		utils.HTTPError(w, "Failed to scan request", http.StatusBadGateway, err)
-		return
+	w.Header().Set("Content-Type", "message/http")
+	if truncated {
+		w.Header().Set("X-Raw-Truncated", "true")
 	}
-	defer resp.Body.Close()
+	w.Write(raw)
+}
 
-	body, err := io.ReadAll(resp.Body)
+func (h *Handler) GetResponse(w http.ResponseWriter, r *http.Request) {
+	responseID := mux.Vars(r)["id"]
+	resp, err := h.responses.Get(responseID)
 	if err != nil {
-		utils.HTTPError(w, "Failed to read response", http.StatusInternalServerError, err)
+		utils.HTTPError(w, "Failed to get response", http.StatusNotFound, err)
 		return
 	}
 
-	result := buildScanResult(body)
-	w.Write(result)
-}
-
-func buildScanResult(body []byte) []byte {
-	if xxe.IsVulnerable(body) {
-		return []byte("Request vulnerable, response:\n" + string(body) + "\n")
+	if err := encodeJSONResponse(w, resp); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
 	}
-	return []byte("Request is not vulnerable, response:\n" + string(body) + "\n")
 }
 
-func (h *Handler) GetResponse(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) GetRawResponse(w http.ResponseWriter, r *http.Request) {
 	responseID := mux.Vars(r)["id"]
 	resp, err := h.responses.Get(responseID)
 	if err != nil {
@@ -220,9 +179,20 @@ func (h *Handler) GetResponse(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := encodeJSONResponse(w, resp); err != nil {
-		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	writeRaw(w, resp.Raw, resp.RawTruncated)
+}
+
+func (h *Handler) GetResponseBody(w http.ResponseWriter, r *http.Request) {
+	responseID := mux.Vars(r)["id"]
+	body, err := h.responses.OpenBody(responseID)
+	if err != nil {
+		utils.HTTPError(w, "Failed to get response body", http.StatusNotFound, err)
+		return
 	}
+	defer body.Close()
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	io.Copy(w, body)
 }
 
 func (h *Handler) GetRequestResponse(w http.ResponseWriter, r *http.Request) {
@@ -239,18 +209,30 @@ func (h *Handler) GetRequestResponse(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *Handler) ListResponses(w http.ResponseWriter, r *http.Request) {
-	limit, err := parseLimitParam(r)
+	filter, err := parseFilter(r)
+	if err == nil {
+		err = responseFilter(filter)
+	}
 	if err != nil {
-		limit = defaultListSize
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
+		return
 	}
 
-	responses, err := h.responses.List(limit)
+	responses, err := h.responses.List(filter, h.parsePage(r))
+	if errors.Is(err, repo.ErrInvalidCursor) {
+		utils.HTTPError(w, "Invalid cursor", http.StatusBadRequest, err)
+		return
+	}
+	if errors.Is(err, repo.ErrScanLimit) {
+		utils.HTTPError(w, "Invalid filter", http.StatusBadRequest, err)
+		return
+	}
 	if err != nil {
 		utils.HTTPError(w, "Failed to list responses", http.StatusInternalServerError, err)
 		return
 	}
 
-	if err := encodeJSONResponse(w, responses); err != nil {
+	if err := encodeJSONResponse(w, newListResponse(r, responses.Items, responses.Next)); err != nil {
 		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
 	}
 }
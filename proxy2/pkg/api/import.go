@@ -0,0 +1,46 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"http-proxy/pkg/http_utils"
+	"http-proxy/pkg/importer"
+	"http-proxy/repo"
+)
+
+// importFailure reports the records created before an import failed.
+type importFailure struct {
+	Error   string            `json:"error"`
+	Results []importer.Result `json:"results"`
+}
+
+// maxImportSize limits uploaded files, which are parsed in memory.
+const maxImportSize = 256 << 20
+
+// Import stores the exchanges of a HAR or Burp XML file sent as the body.
+// The format query parameter overrides the detection from the content. If
+// storing fails, the records created before the failure are returned along
+// with the error.
+func (h *Handler) Import(w http.ResponseWriter, r *http.Request) {
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+
+	exchanges, err := importer.Read(body, r.URL.Query().Get("format"))
+	if err != nil {
+		utils.HTTPError(w, "Failed to read file", http.StatusBadRequest, err)
+		return
+	}
+
+	results, err := importer.Save(exchanges, h.requests, h.responses, repo.WithBodyLimit(h.options.BodyLimit))
+	if err != nil {
+		// The exchanges before the failing one are stored already.
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(importFailure{Error: "Failed to import file: " + err.Error(), Results: results})
+		return
+	}
+
+	if err := encodeJSONResponse(w, results); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
+}
@@ -0,0 +1,135 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseFilter reads the list filters from the query string. Time bounds are
+// RFC 3339, header and param may be repeated.
+func parseFilter(r *http.Request) (repo.Filter, error) {
+	query := r.URL.Query()
+
+	filter := repo.Filter{
+		Host:        query.Get("host"),
+		Method:      query.Get("method"),
+		Path:        query.Get("path"),
+		ContentType: query.Get("content_type"),
+		Headers:     query["header"],
+		Params:      query["param"],
+		Body:        query.Get("q"),
+		Source:      query.Get("source"),
+	}
+
+	var err error
+	if pattern := query.Get("path_regex"); pattern != "" {
+		if filter.PathRegex, err = regexp.Compile(pattern); err != nil {
+			return filter, fmt.Errorf("invalid path_regex: %w", err)
+		}
+	}
+	if status := query.Get("status"); status != "" {
+		if filter.Code, err = strconv.Atoi(status); err != nil {
+			return filter, fmt.Errorf("invalid status: %w", err)
+		}
+	}
+	if parent := query.Get("parent"); parent != "" {
+		if filter.Parent, err = primitive.ObjectIDFromHex(parent); err != nil {
+			return filter, fmt.Errorf("invalid parent: %w", err)
+		}
+	}
+	if filter.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		return filter, fmt.Errorf("invalid since: %w", err)
+	}
+	if filter.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		return filter, fmt.Errorf("invalid until: %w", err)
+	}
+
+	return filter, filter.Validate()
+}
+
+// requestFilter rejects the filters that only apply to responses.
+func requestFilter(filter repo.Filter) error {
+	if filter.Code != 0 {
+		return errors.New("status applies to responses only")
+	}
+	return nil
+}
+
+// responseFilter rejects the filters that only apply to requests.
+func responseFilter(filter repo.Filter) error {
+	params := []struct {
+		name string
+		set  bool
+	}{
+		{"host", filter.Host != ""},
+		{"method", filter.Method != ""},
+		{"path", filter.Path != ""},
+		{"path_regex", filter.PathRegex != nil},
+		{"param", len(filter.Params) != 0},
+	}
+
+	for _, param := range params {
+		if param.set {
+			return fmt.Errorf("%s applies to requests only", param.name)
+		}
+	}
+	return nil
+}
+
+func parseTimeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// listResponse is the body of the list endpoints. Next links to the following,
+// older page and is omitted on the last one.
+type listResponse struct {
+	Items interface{} `json:"items"`
+	Next  string      `json:"next,omitempty"`
+}
+
+func newListResponse(r *http.Request, items interface{}, next string) *listResponse {
+	res := &listResponse{Items: items}
+	if next == "" {
+		return res
+	}
+
+	query := r.URL.Query()
+	query.Del("after")
+	query.Set("before", next)
+
+	link := url.URL{Path: r.URL.Path, RawQuery: query.Encode()}
+	res.Next = link.String()
+	return res
+}
+
+// parsePage reads the page from the query string. Missing or invalid limits
+// fall back to the default, larger ones are capped.
+func (h *Handler) parsePage(r *http.Request) repo.Page {
+	query := r.URL.Query()
+
+	limit, err := strconv.ParseInt(query.Get("limit"), 10, 64)
+	if err != nil || limit <= 0 {
+		limit = h.options.ListSize
+	}
+	if h.options.MaxListSize > 0 && limit > h.options.MaxListSize {
+		limit = h.options.MaxListSize
+	}
+
+	return repo.Page{
+		Before: query.Get("before"),
+		After:  query.Get("after"),
+		Limit:  limit,
+	}
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseFilter(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantErr      bool
+		wantRequest  bool
+		wantResponse bool
+	}{
+		{query: "", wantRequest: true, wantResponse: true},
+		{query: "param=id&header=Cookie", wantRequest: true},
+		{query: "param=a.b", wantErr: true},
+		{query: "param=$where", wantErr: true},
+		{query: "header=X.Y", wantErr: true},
+		{query: "param=", wantErr: true},
+		{query: "status=abc", wantErr: true},
+		{query: "status=200&content_type=html", wantResponse: true},
+		{query: "host=example.com", wantRequest: true},
+		{query: "method=POST", wantRequest: true},
+		{query: "path=/api", wantRequest: true},
+		{query: "path_regex=%5E/api", wantRequest: true},
+		{query: "q=secret&source=proxy", wantRequest: true, wantResponse: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			filter, err := parseFilter(httptest.NewRequest("GET", "/requests?"+tt.query, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseFilter error = %v, want error %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if err := requestFilter(filter); (err == nil) != tt.wantRequest {
+				t.Errorf("requestFilter error = %v", err)
+			}
+			if err := responseFilter(filter); (err == nil) != tt.wantResponse {
+				t.Errorf("responseFilter error = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"http-proxy/pkg/http_utils"
+)
+
+// ListInteractions lists the out-of-band payloads which caused interactions,
+// optionally those used for scanning the request given by request_id. With
+// all=true payloads without interactions are listed too.
+func (h *Handler) ListInteractions(w http.ResponseWriter, r *http.Request) {
+	if h.options.OOB == nil {
+		utils.HTTPError(w, "Failed to list interactions", http.StatusNotFound, errors.New("out-of-band listeners are disabled"))
+		return
+	}
+
+	query := r.URL.Query()
+	records := h.options.OOB.List(query.Get("request_id"), query.Get("all") != "true")
+
+	if err := encodeJSONResponse(w, records); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
+}
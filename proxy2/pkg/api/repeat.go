@@ -0,0 +1,517 @@
+package api
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"http-proxy/pkg/http_utils"
+	"http-proxy/pkg/scanner"
+	"http-proxy/repo"
+
+	"github.com/gorilla/mux"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// repeatOverrides change a stored request before it is sent again, missing
+// fields keep the stored values. Raw replaces the whole message instead and
+// is sent verbatim.
+type repeatOverrides struct {
+	Method string `json:"method"`
+	Scheme string `json:"scheme"`
+	// Host replaces the Host header and the server. With Raw it only
+	// selects the server.
+	Host string `json:"host"`
+	// Target is the host:port to connect to if it differs from Host.
+	Target string `json:"target"`
+	Path   string `json:"path"`
+	// Query replaces the whole query string.
+	Query url.Values `json:"query"`
+	// Headers are replaced one by one, null removes a header.
+	Headers map[string][]string `json:"headers"`
+	// Cookies are replaced one by one, null removes a cookie.
+	Cookies map[string]*string `json:"cookies"`
+	Body    *string            `json:"body"`
+	Raw     string             `json:"raw"`
+	// Encoding of Body and Raw, either text or base64.
+	Encoding string `json:"encoding"`
+}
+
+// RepeatResult holds the records stored for a repeated request.
+type RepeatResult struct {
+	Request  *repo.RequestData  `json:"request"`
+	Response *repo.ResponseData `json:"response"`
+}
+
+// outgoing is a serialized request together with where to send it.
+type outgoing struct {
+	raw    []byte
+	scheme string
+	// host is stored for messages without a Host header.
+	host       string
+	target     string
+	serverName string
+}
+
+// EditAndRepeat sends a modified copy of a stored request and stores the
+// copy, linked to the original, together with the response.
+func (h *Handler) EditAndRepeat(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["id"]
+
+	var overrides repeatOverrides
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxImportSize)).Decode(&overrides)
+	if err != nil && !errors.Is(err, io.EOF) {
+		utils.HTTPError(w, "Invalid overrides", http.StatusBadRequest, err)
+		return
+	}
+
+	original, err := h.requests.Get(requestID)
+	if err != nil {
+		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
+		return
+	}
+
+	msg, err := h.buildRepeat(original, &overrides)
+	if err != nil {
+		utils.HTTPError(w, "Failed to build request", http.StatusBadRequest, err)
+		return
+	}
+
+	sent, err := h.send(r.Context(), msg, repo.WithSource(repo.SourceRepeat), repo.WithParent(rootID(original)))
+	if err != nil {
+		utils.HTTPError(w, "Failed to repeat request", http.StatusBadGateway, err)
+		return
+	}
+	sent.response.Body.Close()
+
+	result := &RepeatResult{}
+	if result.Request, err = h.requests.Get(sent.requestID); err == nil {
+		result.Response, err = h.responses.Get(sent.responseID)
+	}
+	if err != nil {
+		utils.HTTPError(w, "Failed to get repeated request", http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := encodeJSONResponse(w, result); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
+}
+
+func (h *Handler) buildRepeat(original *repo.RequestData, o *repeatOverrides) (*outgoing, error) {
+	if o.Raw == "" {
+		req, err := h.requests.GetEncoded(original.ID.Hex())
+		if err != nil {
+			return nil, err
+		}
+		defer req.Body.Close()
+
+		if err := o.apply(req); err != nil {
+			return nil, err
+		}
+
+		msg, err := newOutgoing(original, req)
+		if err != nil {
+			return nil, err
+		}
+		if o.Scheme != "" {
+			msg.scheme = o.Scheme
+			msg.target = defaultTarget(msg.scheme, req.Host)
+		}
+		if o.Target != "" {
+			msg.target = o.Target
+		}
+		return msg, msg.validate()
+	}
+
+	raw, err := decodeOverride(o.Raw, o.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	host := parseRaw(raw, original.Host).Host
+	if o.Host != "" {
+		host = o.Host
+	}
+
+	scheme := original.Scheme
+	if o.Scheme != "" {
+		scheme = o.Scheme
+	}
+
+	msg := &outgoing{
+		raw:        raw,
+		scheme:     scheme,
+		host:       host,
+		target:     o.Target,
+		serverName: serverName(original, host),
+	}
+	if msg.target == "" {
+		msg.target = defaultTarget(scheme, host)
+	}
+	return msg, msg.validate()
+}
+
+// newOutgoing serializes a request built from original, which is sent to the
+// host of the request.
+func newOutgoing(original *repo.RequestData, req *http.Request) (*outgoing, error) {
+	// Write adds a User-Agent unless the header is present.
+	if _, ok := req.Header["User-Agent"]; !ok {
+		req.Header["User-Agent"] = nil
+	}
+
+	var buf bytes.Buffer
+	if err := scanner.WriteRequest(&buf, req); err != nil {
+		return nil, err
+	}
+
+	return &outgoing{
+		raw:        buf.Bytes(),
+		scheme:     original.Scheme,
+		host:       req.Host,
+		target:     defaultTarget(original.Scheme, req.Host),
+		serverName: serverName(original, req.Host),
+	}, nil
+}
+
+func (msg *outgoing) validate() error {
+	if msg.scheme != "http" && msg.scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", msg.scheme)
+	}
+	return nil
+}
+
+func defaultTarget(scheme, host string) string {
+	u := &url.URL{Scheme: scheme, Host: host}
+	return net.JoinHostPort(u.Hostname(), utils.GetPort(u))
+}
+
+// serverName keeps the SNI of the original request unless the host changed.
+func serverName(original *repo.RequestData, host string) string {
+	if host == original.Host && original.SNI != "" {
+		return original.SNI
+	}
+	return (&url.URL{Host: host}).Hostname()
+}
+
+// rootID returns the request that derived requests are linked to, so that
+// derivatives of derivatives are listed with the original.
+func rootID(original *repo.RequestData) string {
+	if original.ParentID != nil {
+		return original.ParentID.Hex()
+	}
+	return original.ID.Hex()
+}
+
+func (o *repeatOverrides) apply(req *http.Request) error {
+	if o.Method != "" {
+		req.Method = o.Method
+	}
+	if o.Host != "" {
+		req.Host = o.Host
+	}
+	if o.Path != "" {
+		req.URL.Path = o.Path
+		req.URL.RawPath = ""
+	}
+	if o.Query != nil {
+		req.URL.RawQuery = o.Query.Encode()
+	}
+
+	for name, values := range o.Headers {
+		if strings.EqualFold(name, "Host") && len(values) != 0 {
+			req.Host = values[0]
+			continue
+		}
+		if values == nil {
+			req.Header.Del(name)
+		} else {
+			req.Header[http.CanonicalHeaderKey(name)] = values
+		}
+	}
+
+	if o.Cookies != nil {
+		applyCookies(req, o.Cookies)
+	}
+
+	if o.Body != nil {
+		body, err := decodeOverride(*o.Body, o.Encoding)
+		if err != nil {
+			return err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(body))
+		req.ContentLength = int64(len(body))
+		req.TransferEncoding = nil
+	}
+
+	return nil
+}
+
+// applyCookies keeps the order of the existing cookies and appends new ones.
+func applyCookies(req *http.Request, overrides map[string]*string) {
+	var cookies []*http.Cookie
+	existing := make(map[string]bool)
+
+	for _, cookie := range req.Cookies() {
+		existing[cookie.Name] = true
+
+		value, ok := overrides[cookie.Name]
+		if !ok {
+			cookies = append(cookies, cookie)
+		} else if value != nil {
+			cookies = append(cookies, &http.Cookie{Name: cookie.Name, Value: *value})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(overrides)) {
+		if value := overrides[name]; value != nil && !existing[name] {
+			cookies = append(cookies, &http.Cookie{Name: name, Value: *value})
+		}
+	}
+
+	req.Header.Del("Cookie")
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+}
+
+// RepeatRequest sends a stored request again and forwards the response.
+// With mode=raw the captured bytes are sent verbatim.
+func (h *Handler) RepeatRequest(w http.ResponseWriter, r *http.Request) {
+	requestID := mux.Vars(r)["id"]
+	original, err := h.requests.Get(requestID)
+	if err != nil {
+		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
+		return
+	}
+
+	overrides := &repeatOverrides{}
+	if r.URL.Query().Get("mode") == "raw" {
+		if len(original.Raw) == 0 || original.RawTruncated {
+			utils.HTTPError(w, "Failed to repeat request", http.StatusConflict, errors.New("no complete raw capture"))
+			return
+		}
+		overrides.Raw = base64.StdEncoding.EncodeToString(original.Raw)
+		overrides.Encoding = repo.BodyEncodingBase64
+	}
+
+	msg, err := h.buildRepeat(original, overrides)
+	if err != nil {
+		utils.HTTPError(w, "Failed to build request", http.StatusInternalServerError, err)
+		return
+	}
+
+	sent, err := h.send(r.Context(), msg, repo.WithSource(repo.SourceRepeat), repo.WithParent(rootID(original)))
+	if err != nil {
+		utils.HTTPError(w, "Failed to repeat request", http.StatusBadGateway, err)
+		return
+	}
+	defer sent.response.Body.Close()
+
+	w.Header().Set("X-Request-Id", sent.requestID)
+	w.Header().Set("X-Response-Id", sent.responseID)
+	if err := forwardResponse(w, sent.response); err != nil {
+		utils.HTTPError(w, "Failed to forward response", http.StatusInternalServerError, err)
+	}
+}
+
+func forwardResponse(w http.ResponseWriter, resp *http.Response) error {
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+
+	_, err := io.Copy(w, resp.Body)
+	return err
+}
+
+func decodeOverride(value, encoding string) ([]byte, error) {
+	switch encoding {
+	case "", repo.BodyEncodingText:
+		return []byte(value), nil
+	case repo.BodyEncodingBase64:
+		return base64.StdEncoding.DecodeString(value)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// sent identifies the records stored for a request sent by the API. The
+// body of response replays the bytes as received and must be closed.
+type sent struct {
+	requestID  string
+	responseID string
+	response   *http.Response
+	timings    repo.Timings
+}
+
+// parseRaw parses a raw request as far as it is valid HTTP. Messages which
+// are not, e.g. malformed or smuggling ones, still get the method and target
+// of their request line, and host if they have no Host header.
+func parseRaw(raw []byte, host string) *http.Request {
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		req = &http.Request{Method: http.MethodGet, URL: &url.URL{Path: "/"}, Header: http.Header{}, Body: http.NoBody}
+
+		line, _, _ := bytes.Cut(raw, []byte("\n"))
+		fields := strings.Fields(string(line))
+		if len(fields) > 0 {
+			req.Method = fields[0]
+		}
+		if len(fields) > 1 {
+			if u, err := url.ParseRequestURI(fields[1]); err == nil {
+				req.URL = u
+			}
+		}
+	}
+
+	if req.Host == "" {
+		req.Host = host
+	}
+	return req
+}
+
+// send writes the message as it is over a new connection and stores it
+// together with the response. The exchange is aborted when ctx is done.
+func (h *Handler) send(ctx context.Context, msg *outgoing, opts ...repo.SaveOption) (*sent, error) {
+	// The request is parsed only to read the response and to store it.
+	req := parseRaw(msg.raw, msg.host)
+	req.URL.Scheme = msg.scheme
+
+	start := time.Now()
+	conn, state, err := dial(msg.scheme, msg.target, msg.serverName, h.options.UpstreamTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	req.TLS = state
+
+	// Every step is limited by the upstream timeout, the exchange as a whole
+	// by the API timeout.
+	ctx, cancel := context.WithTimeout(ctx, h.options.Timeout)
+	defer cancel()
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	connected := time.Now()
+	if _, err := conn.Write(msg.raw); err != nil {
+		return nil, aborted(ctx, fmt.Errorf("write request failed: %w", err))
+	}
+	sentAt := time.Now()
+
+	raw := &rawBuffer{limit: h.rawLimit()}
+	resp, err := http.ReadResponse(bufio.NewReader(io.TeeReader(conn, raw)), req)
+	if err != nil {
+		return nil, aborted(ctx, fmt.Errorf("read response failed: %w", err))
+	}
+	headers := time.Now()
+
+	body := repo.NewCapture(resp.Body, h.options.BodyLimit)
+	resp.Body = body
+	if err := body.Drain(); err != nil {
+		body.Release()
+		return nil, aborted(ctx, err)
+	}
+
+	timings := repo.Timings{
+		Started: primitive.NewDateTimeFromTime(start),
+		Connect: millis(connected.Sub(start)),
+		Send:    millis(sentAt.Sub(connected)),
+		Wait:    millis(headers.Sub(sentAt)),
+		Receive: millis(time.Since(headers)),
+	}
+
+	opts = append(opts, repo.WithBodyLimit(h.options.BodyLimit))
+	res := &sent{response: resp, timings: timings}
+	if res.requestID, err = h.requests.Save(req, append(opts, repo.WithRaw(msg.raw, false))...); err == nil {
+		res.responseID, err = h.responses.Save(res.requestID, resp,
+			append(opts, repo.WithRaw(raw.Bytes(), raw.truncated), repo.WithTimings(timings))...)
+	}
+	if err == nil {
+		resp.Body, err = body.Replay()
+	}
+	if err != nil {
+		body.Release()
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// aborted reports why ctx was done, which is the cause of err if it was.
+func aborted(ctx context.Context, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %w", context.Cause(ctx), err)
+	}
+	return err
+}
+
+// rawLimit is the part of a response kept as raw message, which leaves room
+// for the head on top of the body limit.
+func (h *Handler) rawLimit() int {
+	return int(h.options.BodyLimit) + 64<<10
+}
+
+// dial connects to a host:port, returning the TLS state for https.
+func dial(scheme, target, serverName string, timeout time.Duration) (net.Conn, *tls.ConnectionState, error) {
+	host, port, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if scheme != "https" {
+		conn, err := utils.TCPConnect(host, port, timeout)
+		if err != nil {
+			return nil, nil, err
+		}
+		return utils.WithIdleTimeout(conn, timeout), nil, nil
+	}
+
+	conn, err := utils.TLSConnect(host, port, serverName, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var state *tls.ConnectionState
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		s := tlsConn.ConnectionState()
+		state = &s
+	}
+	return utils.WithIdleTimeout(conn, timeout), state, nil
+}
+
+// rawBuffer keeps the first limit bytes written to it.
+type rawBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *rawBuffer) Write(p []byte) (int, error) {
+	if room := max(b.limit-b.Len(), 0); len(p) > room {
+		b.Buffer.Write(p[:room])
+		b.truncated = true
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
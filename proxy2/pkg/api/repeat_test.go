@@ -0,0 +1,481 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"http-proxy/repo"
+
+	"github.com/gorilla/mux"
+)
+
+// received is the last request a test server got.
+type received struct {
+	mu            sync.Mutex
+	method        string
+	uri           string
+	host          string
+	header        http.Header
+	body          string
+	contentLength int64
+}
+
+func (r *received) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method, r.uri, r.host = req.Method, req.RequestURI, req.Host
+	r.header, r.body, r.contentLength = req.Header.Clone(), string(body), req.ContentLength
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok"))
+}
+
+func (r *received) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.method, r.uri, r.host, r.header, r.body, r.contentLength = "", "", "", nil, "", 0
+}
+
+func newTestHandler() *Handler {
+	blobs := repo.NewMemoryBlobStore()
+	return NewHandler(repo.NewMemoryRequestSaver(blobs), repo.NewMemoryResponseSaver(blobs), Options{
+		Timeout:         5 * time.Second,
+		UpstreamTimeout: 5 * time.Second,
+		BodyLimit:       1 << 20,
+		ListSize:        50,
+	})
+}
+
+// saveOriginal stores a POST request to host with a body and cookies.
+func saveOriginal(t *testing.T, h *Handler, scheme, host string) string {
+	t.Helper()
+
+	req := httptest.NewRequest(http.MethodPost, scheme+"://"+host+"/items?id=1", strings.NewReader("name=chair&price=10"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("Cookie", "session=abc; theme=dark")
+
+	id, err := h.requests.Save(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// repeatResult is the part of RepeatResult the tests look at.
+type repeatResult struct {
+	Request struct {
+		ID       string
+		Method   string
+		Host     string
+		Path     string
+		Source   string
+		ParentID string
+	}
+	Response struct {
+		Code int
+	}
+}
+
+func editAndRepeat(h *Handler, id, overrides string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/repeat/"+id, strings.NewReader(overrides))
+	r = mux.SetURLVars(r, map[string]string{"id": id})
+	w := httptest.NewRecorder()
+	h.EditAndRepeat(w, r)
+	return w
+}
+
+func TestEditAndRepeat(t *testing.T) {
+	got := &received{}
+	server := httptest.NewServer(got)
+	defer server.Close()
+	addr := server.Listener.Addr().String()
+
+	tests := []struct {
+		name      string
+		scheme    string
+		overrides string
+
+		wantStatus int
+		// want checks the request the server received.
+		want func(t *testing.T, got *received)
+		// wantMethod, wantHost and wantPath are stored for the repeated
+		// request.
+		wantMethod, wantHost, wantPath string
+	}{
+		{
+			name:      "unchanged",
+			overrides: `{}`,
+			want: func(t *testing.T, got *received) {
+				if got.method != http.MethodPost || got.uri != "/items?id=1" || got.body != "name=chair&price=10" {
+					t.Errorf("received %s %s %q", got.method, got.uri, got.body)
+				}
+				if got.header.Get("Cookie") != "session=abc; theme=dark" || got.header.Get("Accept") != "text/html" {
+					t.Errorf("headers = %v", got.header)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:      "method, path and query",
+			overrides: `{"method": "PUT", "path": "/items/2", "query": {"v": ["a b"]}}`,
+			want: func(t *testing.T, got *received) {
+				if got.method != http.MethodPut || got.uri != "/items/2?v=a+b" {
+					t.Errorf("received %s %s", got.method, got.uri)
+				}
+			},
+			wantMethod: http.MethodPut,
+			wantPath:   "/items/2",
+		},
+		{
+			name:      "headers",
+			overrides: `{"headers": {"x-new": ["1", "2"], "Accept": null}}`,
+			want: func(t *testing.T, got *received) {
+				if values := got.header.Values("X-New"); len(values) != 2 || values[1] != "2" {
+					t.Errorf("X-New = %q", values)
+				}
+				if _, ok := got.header["Accept"]; ok {
+					t.Errorf("Accept not removed: %v", got.header)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:      "cookies",
+			overrides: `{"cookies": {"session": null, "theme": "light", "lang": "en"}}`,
+			want: func(t *testing.T, got *received) {
+				if cookie := got.header.Get("Cookie"); cookie != "theme=light; lang=en" {
+					t.Errorf("Cookie = %q", cookie)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:      "body",
+			overrides: `{"body": "name=table"}`,
+			want: func(t *testing.T, got *received) {
+				if got.body != "name=table" || got.contentLength != 10 {
+					t.Errorf("body = %q, Content-Length %d", got.body, got.contentLength)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:      "base64 body",
+			overrides: `{"body": "AAEC/w==", "encoding": "base64", "headers": {"Content-Type": ["application/octet-stream"]}}`,
+			want: func(t *testing.T, got *received) {
+				if got.body != "\x00\x01\x02\xff" || got.contentLength != 4 {
+					t.Errorf("body = %q, Content-Length %d", got.body, got.contentLength)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:      "host and target",
+			overrides: `{"host": "shop.test", "target": "` + addr + `"}`,
+			want: func(t *testing.T, got *received) {
+				if got.host != "shop.test" {
+					t.Errorf("Host = %q", got.host)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantHost:   "shop.test",
+			wantPath:   "/items",
+		},
+		{
+			name:      "host header",
+			overrides: `{"headers": {"host": ["shop.test"]}, "target": "` + addr + `"}`,
+			want: func(t *testing.T, got *received) {
+				if got.host != "shop.test" {
+					t.Errorf("Host = %q", got.host)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantHost:   "shop.test",
+			wantPath:   "/items",
+		},
+		{
+			name:      "https to http",
+			scheme:    "https",
+			overrides: `{"scheme": "http"}`,
+			want: func(t *testing.T, got *received) {
+				if got.uri != "/items?id=1" {
+					t.Errorf("received %s", got.uri)
+				}
+			},
+			wantMethod: http.MethodPost,
+			wantPath:   "/items",
+		},
+		{
+			name:       "https to a plain server",
+			overrides:  `{"scheme": "https"}`,
+			wantStatus: http.StatusBadGateway,
+		},
+		{
+			name:      "raw",
+			overrides: `{"raw": "DELETE /raw?x=1 HTTP/1.1\r\nHost: raw.test\r\nContent-Length: 3\r\n\r\nabc", "target": "` + addr + `"}`,
+			want: func(t *testing.T, got *received) {
+				if got.method != http.MethodDelete || got.uri != "/raw?x=1" || got.host != "raw.test" || got.body != "abc" {
+					t.Errorf("received %s %s %s %q", got.method, got.uri, got.host, got.body)
+				}
+			},
+			wantMethod: http.MethodDelete,
+			wantHost:   "raw.test",
+			wantPath:   "/raw",
+		},
+		{
+			name:       "unsupported scheme",
+			overrides:  `{"scheme": "ftp"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "bad encoding",
+			overrides:  `{"body": "x", "encoding": "hex"}`,
+			wantStatus: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got.reset()
+			h := newTestHandler()
+
+			scheme := tt.scheme
+			if scheme == "" {
+				scheme = "http"
+			}
+			id := saveOriginal(t, h, scheme, addr)
+
+			w := editAndRepeat(h, id, tt.overrides)
+			wantStatus := tt.wantStatus
+			if wantStatus == 0 {
+				wantStatus = http.StatusOK
+			}
+			if w.Code != wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, wantStatus, w.Body)
+			}
+			if wantStatus != http.StatusOK {
+				return
+			}
+
+			got.mu.Lock()
+			tt.want(t, got)
+			got.mu.Unlock()
+
+			var result repeatResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			wantHost := tt.wantHost
+			if wantHost == "" {
+				wantHost = addr
+			}
+			if result.Request.Method != tt.wantMethod || result.Request.Host != wantHost || result.Request.Path != tt.wantPath {
+				t.Errorf("stored %s %s%s, want %s %s%s", result.Request.Method, result.Request.Host, result.Request.Path,
+					tt.wantMethod, wantHost, tt.wantPath)
+			}
+			if result.Request.Source != repo.SourceRepeat || result.Request.ParentID != id {
+				t.Errorf("source %q, parent %q, want %q", result.Request.Source, result.Request.ParentID, id)
+			}
+			if result.Response.Code != http.StatusOK {
+				t.Errorf("stored response code %d", result.Response.Code)
+			}
+		})
+	}
+}
+
+// rawServer answers every connection with an empty response after reading
+// what the client wrote, which it keeps.
+type rawServer struct {
+	net.Listener
+	mu   sync.Mutex
+	read []byte
+}
+
+func newRawServer(t *testing.T) *rawServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &rawServer{Listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			var read []byte
+			buf := make([]byte, 4096)
+			for {
+				conn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+				n, err := conn.Read(buf)
+				read = append(read, buf[:n]...)
+				if err != nil {
+					break
+				}
+			}
+
+			s.mu.Lock()
+			s.read = read
+			s.mu.Unlock()
+
+			conn.Write([]byte("HTTP/1.1 400 Bad Request\r\nContent-Length: 0\r\n\r\n"))
+			conn.Close()
+		}
+	}()
+	return s
+}
+
+func TestEditAndRepeatRaw(t *testing.T) {
+	server := newRawServer(t)
+	defer server.Close()
+	addr := server.Addr().String()
+
+	tests := []struct {
+		name                 string
+		raw                  string
+		wantMethod, wantPath string
+	}{
+		{
+			name:       "malformed header",
+			raw:        "GET /a HTTP/1.1\r\nHost: raw.test\r\nBroken header\r\n\r\n",
+			wantMethod: http.MethodGet,
+			wantPath:   "/a",
+		},
+		{
+			name:       "smuggling",
+			raw:        "POST /b HTTP/1.1\r\nHost: raw.test\r\nContent-Length: 4\r\nTransfer-Encoding: chunked\r\nTransfer-Encoding: identity\r\n\r\n0\r\n\r\nGET /admin HTTP/1.1\r\n\r\n",
+			wantMethod: http.MethodPost,
+			wantPath:   "/b",
+		},
+		{
+			name:       "pipelined",
+			raw:        "GET /c HTTP/1.1\r\nHost: raw.test\r\n\r\nGET /d HTTP/1.1\r\nHost: raw.test\r\n\r\n",
+			wantMethod: http.MethodGet,
+			wantPath:   "/c",
+		},
+		{
+			name:       "not http",
+			raw:        "BREW pot\r\n\r\n",
+			wantMethod: "BREW",
+			wantPath:   "/",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newTestHandler()
+			id := saveOriginal(t, h, "http", addr)
+
+			overrides, _ := json.Marshal(repeatOverrides{Raw: tt.raw, Target: addr})
+			w := editAndRepeat(h, id, string(overrides))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+
+			server.mu.Lock()
+			read := string(server.read)
+			server.mu.Unlock()
+			if read != tt.raw {
+				t.Errorf("server read %q, want %q", read, tt.raw)
+			}
+
+			var result repeatResult
+			if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+				t.Fatal(err)
+			}
+			if result.Request.Method != tt.wantMethod || result.Request.Path != tt.wantPath || result.Response.Code != http.StatusBadRequest {
+				t.Errorf("stored %s %s with response %d", result.Request.Method, result.Request.Path, result.Response.Code)
+			}
+
+			stored, err := h.requests.Get(result.Request.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(stored.Raw) != tt.raw {
+				t.Errorf("stored raw %q", stored.Raw)
+			}
+		})
+	}
+}
+
+func TestRepeatLineage(t *testing.T) {
+	server := httptest.NewServer(&received{})
+	defer server.Close()
+
+	h := newTestHandler()
+	root := saveOriginal(t, h, "http", server.Listener.Addr().String())
+	saveOriginal(t, h, "http", server.Listener.Addr().String())
+
+	r := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/requests/"+root+"/repeat", nil), map[string]string{"id": root})
+	w := httptest.NewRecorder()
+	h.RepeatRequest(w, r)
+	child := w.Header().Get("X-Request-Id")
+	if w.Code != http.StatusOK || child == "" {
+		t.Fatalf("repeat status %d: %s", w.Code, w.Body)
+	}
+
+	// Repeating a derivative links the new request to the original.
+	w = editAndRepeat(h, child, `{"method": "PUT"}`)
+	var result repeatResult
+	if err := json.NewDecoder(w.Body).Decode(&result); err != nil {
+		t.Fatal(err)
+	}
+	grandchild := result.Request.ID
+
+	tests := []struct {
+		id   string
+		want []string
+	}{
+		{id: root, want: []string{grandchild, child}},
+		{id: child},
+	}
+
+	for _, tt := range tests {
+		r := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/requests/"+tt.id+"/derivatives", nil), map[string]string{"id": tt.id})
+		w := httptest.NewRecorder()
+		h.ListDerivatives(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("derivatives status %d: %s", w.Code, w.Body)
+		}
+
+		var list struct {
+			Items []struct {
+				ID       string
+				Source   string
+				ParentID string
+			} `json:"items"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []string
+		for _, item := range list.Items {
+			ids = append(ids, item.ID)
+			if item.Source != repo.SourceRepeat || item.ParentID != root {
+				t.Errorf("derivative %s: source %q, parent %s", item.ID, item.Source, item.ParentID)
+			}
+		}
+		if !slices.Equal(ids, tt.want) {
+			t.Errorf("derivatives of %s = %v, want %v", tt.id, ids, tt.want)
+		}
+	}
+}
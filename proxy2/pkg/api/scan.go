@@ -0,0 +1,120 @@
+package api
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"http-proxy/pkg/http_utils"
+	"http-proxy/pkg/scanner"
+	"http-proxy/repo"
+
+	"github.com/gorilla/mux"
+)
+
+// ScanRequest runs the enabled checks, or the comma separated ones given by
+// the checks query parameter, against a stored request. The scan stops when
+// the client goes away or it runs out of time or requests, checks which did
+// not finish are reported as errors.
+func (h *Handler) ScanRequest(w http.ResponseWriter, r *http.Request) {
+	var names []string
+	if value := r.URL.Query().Get("checks"); value != "" {
+		names = strings.Split(value, ",")
+	}
+
+	checks, err := h.options.Checks.Select(names)
+	if err != nil {
+		utils.HTTPError(w, "Invalid checks", http.StatusBadRequest, err)
+		return
+	}
+
+	requestID := mux.Vars(r)["id"]
+	original, err := h.requests.Get(requestID)
+	if err != nil {
+		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), h.options.ScanTimeout)
+	defer cancel()
+
+	target := scanner.NewTarget(ctx, original, &scanClient{h: h, original: original}, h.options.OOB)
+	target.MaxRequests = h.options.ScanMaxRequests
+	report := scanner.Run(target, checks)
+
+	if err := encodeJSONResponse(w, report); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
+}
+
+// ListInsertionPoints lists where checks put their payloads in a stored
+// request.
+func (h *Handler) ListInsertionPoints(w http.ResponseWriter, r *http.Request) {
+	req, err := h.requests.GetEncoded(mux.Vars(r)["id"])
+	if err != nil {
+		utils.HTTPError(w, "Failed to get request", http.StatusNotFound, err)
+		return
+	}
+	defer req.Body.Close()
+
+	points, err := scanner.InsertionPoints(req)
+	if err != nil {
+		utils.HTTPError(w, "Failed to read request", http.StatusInternalServerError, err)
+		return
+	}
+
+	if points == nil {
+		points = []*scanner.InsertionPoint{}
+	}
+	if err := encodeJSONResponse(w, points); err != nil {
+		utils.HTTPError(w, "Failed to encode response", http.StatusInternalServerError, err)
+	}
+}
+
+// scanClient sends the requests of checks, storing them as derivatives of
+// the scanned request.
+type scanClient struct {
+	h        *Handler
+	original *repo.RequestData
+}
+
+func (c *scanClient) Request() (*http.Request, error) {
+	return c.h.requests.GetEncoded(c.original.ID.Hex())
+}
+
+func (c *scanClient) Send(req *http.Request) (*scanner.Response, error) {
+	msg, err := newOutgoing(c.original, req)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sent, err := c.h.send(req.Context(), msg, repo.WithSource(repo.SourceScan), repo.WithParent(rootID(c.original)))
+	if err != nil {
+		return nil, err
+	}
+	defer sent.response.Body.Close()
+
+	// Checks look at as many body bytes as records store inline.
+	body, err := io.ReadAll(io.LimitReader(sent.response.Body, c.h.options.BodyLimit))
+	if err != nil {
+		return nil, err
+	}
+
+	if encodings := utils.ContentEncodings(sent.response.Header); len(encodings) != 0 {
+		if decoded, err := utils.DecodeBody(body, encodings, c.h.options.BodyLimit); err == nil {
+			body = decoded
+		}
+	}
+
+	return &scanner.Response{
+		RequestID:  sent.requestID,
+		ResponseID: sent.responseID,
+		StatusCode: sent.response.StatusCode,
+		Header:     sent.response.Header,
+		Body:       body,
+		Elapsed:    time.Duration((sent.timings.Send + sent.timings.Wait) * float64(time.Millisecond)),
+	}, nil
+}
@@ -0,0 +1,379 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	caValidity   = 10 * 365 * 24 * time.Hour
+	leafValidity = 365 * 24 * time.Hour
+	clockSkew    = time.Hour
+	caCommonName = "http-proxy CA"
+)
+
+// Authority issues TLS certificates for intercepted hosts.
+type Authority interface {
+	Certificate(host string) (*tls.Certificate, error)
+}
+
+// CA is an Authority that signs leaf certificates with its own key pair.
+// Issued certificates are cached in memory and, if a Store is set, on disk.
+type CA struct {
+	cert    *x509.Certificate
+	key     crypto.Signer
+	leafKey crypto.Signer
+	store   Store
+
+	mutex   sync.Mutex
+	certs   map[string]*tls.Certificate
+	issuing singleflight.Group
+}
+
+// New creates an authority from an existing CA certificate and key. store
+// may be nil.
+func New(cert *x509.Certificate, key crypto.Signer, store Store) (*CA, error) {
+	if !cert.IsCA {
+		return nil, errors.New("certificate is not a CA")
+	}
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate leaf key: %w", err)
+	}
+
+	return &CA{
+		cert:    cert,
+		key:     key,
+		leafKey: leafKey,
+		store:   store,
+		certs:   make(map[string]*tls.Certificate),
+	}, nil
+}
+
+// Generate creates an authority with a fresh in-memory CA key pair.
+func Generate(store Store) (*CA, error) {
+	cert, key, err := generateCA()
+	if err != nil {
+		return nil, err
+	}
+	return New(cert, key, store)
+}
+
+// LoadOrCreate reads the CA certificate and key from the given PEM files,
+// generating and writing them if neither exists yet.
+func LoadOrCreate(certFile, keyFile string, store Store) (*CA, error) {
+	certPEM, certErr := os.ReadFile(certFile)
+	keyPEM, keyErr := os.ReadFile(keyFile)
+
+	if errors.Is(certErr, os.ErrNotExist) && errors.Is(keyErr, os.ErrNotExist) {
+		cert, key, err := generateCA()
+		if err != nil {
+			return nil, err
+		}
+		if err := writeCA(certFile, keyFile, cert, key); err != nil {
+			return nil, err
+		}
+		return New(cert, key, store)
+	}
+	if certErr != nil {
+		return nil, fmt.Errorf("failed to read CA certificate: %w", certErr)
+	}
+	if keyErr != nil {
+		return nil, fmt.Errorf("failed to read CA key: %w", keyErr)
+	}
+
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA certificate: %w", err)
+	}
+
+	key, err := parsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse CA key: %w", err)
+	}
+
+	return New(cert, key, store)
+}
+
+// CertificatePEM returns the CA certificate, e.g. for installing it in a
+// client trust store.
+func (c *CA) CertificatePEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.cert.Raw})
+}
+
+// Pool returns a certificate pool containing only the CA certificate.
+func (c *CA) Pool() *x509.CertPool {
+	pool := x509.NewCertPool()
+	pool.AddCert(c.cert)
+	return pool
+}
+
+// Certificate returns the certificate for host, issuing it on first use.
+// Concurrent calls for the same host wait for a single issue.
+func (c *CA) Certificate(host string) (*tls.Certificate, error) {
+	host = normalizeHost(host)
+	if host == "" {
+		return nil, errors.New("empty host name")
+	}
+
+	if cert := c.cached(host); cert != nil {
+		return cert, nil
+	}
+
+	cert, err, _ := c.issuing.Do(host, func() (interface{}, error) {
+		// The certificate may have been cached since the lookup above.
+		if cert := c.cached(host); cert != nil {
+			return cert, nil
+		}
+		return c.loadOrIssue(host)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cert.(*tls.Certificate), nil
+}
+
+// cached returns the cached certificate for host unless it is about to
+// expire. Cached certificates were issued or verified by this CA.
+func (c *CA) cached(host string) *tls.Certificate {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if cert, ok := c.certs[host]; ok && !expiring(cert) {
+		return cert
+	}
+	return nil
+}
+
+func (c *CA) loadOrIssue(host string) (*tls.Certificate, error) {
+	var cert *tls.Certificate
+	if c.store != nil {
+		stored, err := c.store.Load(host)
+		if err != nil {
+			return nil, err
+		}
+		if stored != nil && c.usable(stored) {
+			cert = stored
+		}
+	}
+
+	if cert == nil {
+		issued, err := c.issue(host)
+		if err != nil {
+			return nil, fmt.Errorf("error generating certificate for %s: %w", host, err)
+		}
+		if c.store != nil {
+			if err := c.store.Save(host, issued); err != nil {
+				return nil, err
+			}
+		}
+		cert = issued
+	}
+
+	c.mutex.Lock()
+	c.certs[host] = cert
+	c.mutex.Unlock()
+
+	return cert, nil
+}
+
+// usable reports whether a stored certificate was signed by this CA and is
+// not about to expire.
+func (c *CA) usable(cert *tls.Certificate) bool {
+	return cert.Leaf != nil && !expiring(cert) && cert.Leaf.CheckSignatureFrom(c.cert) == nil
+}
+
+func expiring(cert *tls.Certificate) bool {
+	return time.Now().Add(clockSkew).After(cert.Leaf.NotAfter)
+}
+
+func (c *CA) issue(host string) (*tls.Certificate, error) {
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: host},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(leafValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	if ip := net.ParseIP(host); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{host}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, c.cert, c.leafKey.Public(), c.key)
+	if err != nil {
+		return nil, err
+	}
+
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Certificate{
+		Certificate: [][]byte{der, c.cert.Raw},
+		PrivateKey:  c.leafKey,
+		Leaf:        leaf,
+	}, nil
+}
+
+func normalizeHost(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.TrimSuffix(strings.Trim(host, "[]"), ".")
+	return strings.ToLower(host)
+}
+
+func generateCA() (*x509.Certificate, crypto.Signer, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key: %w", err)
+	}
+
+	serial, err := randomSerial()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+	keyID := sha1.Sum(publicKey)
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: caCommonName},
+		NotBefore:             now.Add(-clockSkew),
+		NotAfter:              now.Add(caValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		SubjectKeyId:          keyID[:],
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate: %w", err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cert, key, nil
+}
+
+func writeCA(certFile, keyFile string, cert *x509.Certificate, key crypto.Signer) error {
+	keyPEM, err := encodePrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	for _, dir := range []string{filepath.Dir(certFile), filepath.Dir(keyFile)} {
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return fmt.Errorf("failed to create CA directory: %w", err)
+		}
+	}
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return fmt.Errorf("failed to write CA certificate: %w", err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return fmt.Errorf("failed to write CA key: %w", err)
+	}
+
+	return nil
+}
+
+func randomSerial() (*big.Int, error) {
+	limit := new(big.Int).Lsh(big.NewInt(1), 128)
+	serial, err := rand.Int(rand.Reader, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+	return serial, nil
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no PEM private key found")
+		}
+
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			return x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "EC PRIVATE KEY":
+			return x509.ParseECPrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			if err != nil {
+				return nil, err
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("unsupported private key type %T", key)
+			}
+			return signer, nil
+		}
+	}
+}
+
+func encodePrivateKey(key crypto.Signer) ([]byte, error) {
+	switch key.(type) {
+	case *ecdsa.PrivateKey, *rsa.PrivateKey:
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
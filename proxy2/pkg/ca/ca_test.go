@@ -0,0 +1,325 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca", "ca.crt")
+	keyFile := filepath.Join(dir, "ca", "ca.key")
+
+	created, err := LoadOrCreate(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	for _, file := range []string{certFile, keyFile} {
+		if _, err := os.Stat(file); err != nil {
+			t.Fatalf("%s not written: %v", file, err)
+		}
+	}
+	if info, _ := os.Stat(keyFile); info.Mode().Perm() != 0o600 {
+		t.Errorf("key mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadOrCreate(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if !loaded.cert.Equal(created.cert) {
+		t.Error("loaded CA differs from the created one")
+	}
+
+	// Certificates of the loaded CA verify against the created one.
+	cert, err := loaded.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cert.Leaf.Verify(x509.VerifyOptions{DNSName: "example.com", Roots: created.Pool()}); err != nil {
+		t.Errorf("verify: %v", err)
+	}
+}
+
+func TestLoadOrCreateMissingKey(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "ca.crt")
+	keyFile := filepath.Join(dir, "ca.key")
+
+	if _, err := LoadOrCreate(certFile, keyFile, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(keyFile); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := LoadOrCreate(certFile, keyFile, nil); err == nil {
+		t.Error("no error with the key missing")
+	}
+	if _, err := os.Stat(keyFile); err == nil {
+		t.Error("key regenerated for an existing certificate")
+	}
+}
+
+func TestCertificateSubjectAltNames(t *testing.T) {
+	ca, err := Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host    string
+		dnsName string
+		ip      string
+	}{
+		{host: "example.com", dnsName: "example.com"},
+		{host: "Example.COM:443", dnsName: "example.com"},
+		{host: "example.com.", dnsName: "example.com"},
+		{host: "127.0.0.1", ip: "127.0.0.1"},
+		{host: "10.0.0.1:8443", ip: "10.0.0.1"},
+		{host: "[::1]:443", ip: "::1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			cert, err := ca.Certificate(tt.host)
+			if err != nil {
+				t.Fatal(err)
+			}
+			leaf := cert.Leaf
+
+			if tt.dnsName != "" {
+				if len(leaf.DNSNames) != 1 || leaf.DNSNames[0] != tt.dnsName || len(leaf.IPAddresses) != 0 {
+					t.Errorf("SANs = %v %v, want DNS %s", leaf.DNSNames, leaf.IPAddresses, tt.dnsName)
+				}
+			} else {
+				if len(leaf.IPAddresses) != 1 || !leaf.IPAddresses[0].Equal(net.ParseIP(tt.ip)) || len(leaf.DNSNames) != 0 {
+					t.Errorf("SANs = %v %v, want IP %s", leaf.DNSNames, leaf.IPAddresses, tt.ip)
+				}
+			}
+
+			if err := leaf.CheckSignatureFrom(ca.cert); err != nil {
+				t.Errorf("not signed by the CA: %v", err)
+			}
+			if len(cert.Certificate) != 2 || !ca.cert.Equal(mustParse(t, cert.Certificate[1])) {
+				t.Error("chain does not end with the CA certificate")
+			}
+		})
+	}
+
+	if _, err := ca.Certificate(""); err == nil {
+		t.Error("no error for an empty host")
+	}
+}
+
+func TestCertificateCache(t *testing.T) {
+	ca, err := Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := ca.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := ca.Certificate("EXAMPLE.com:443")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("certificate not reused for the same host")
+	}
+
+	// A certificate about to expire is replaced.
+	expiring := *first
+	leaf := *first.Leaf
+	leaf.NotAfter = time.Now().Add(clockSkew / 2)
+	expiring.Leaf = &leaf
+	ca.certs["example.com"] = &expiring
+
+	renewed, err := ca.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if renewed == &expiring || !renewed.Leaf.NotAfter.After(time.Now().Add(clockSkew)) {
+		t.Error("expiring certificate reused")
+	}
+}
+
+// blockingStore counts the saved certificates and holds the saves of one
+// host until release is closed.
+type blockingStore struct {
+	host    string
+	release chan struct{}
+
+	mutex sync.Mutex
+	saves map[string]int
+}
+
+func (s *blockingStore) Load(host string) (*tls.Certificate, error) {
+	return nil, nil
+}
+
+func (s *blockingStore) Save(host string, cert *tls.Certificate) error {
+	if host == s.host {
+		<-s.release
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.saves[host]++
+	return nil
+}
+
+func TestCertificateConcurrent(t *testing.T) {
+	store := &blockingStore{host: "slow.test", release: make(chan struct{}), saves: make(map[string]int)}
+	ca, err := Generate(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const callers = 8
+	certs := make(chan *tls.Certificate, callers)
+	for i := 0; i < callers; i++ {
+		go func() {
+			cert, err := ca.Certificate("slow.test")
+			if err != nil {
+				t.Error(err)
+			}
+			certs <- cert
+		}()
+	}
+
+	// Other hosts are not held up by the slow one.
+	done := make(chan error)
+	go func() {
+		_, err := ca.Certificate("fast.test")
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("certificate of another host waits for a slow save")
+	}
+
+	close(store.release)
+	first := <-certs
+	for i := 1; i < callers; i++ {
+		if cert := <-certs; cert != first {
+			t.Error("concurrent callers got different certificates")
+		}
+	}
+	if store.saves["slow.test"] != 1 {
+		t.Errorf("certificate saved %d times, want once", store.saves["slow.test"])
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDirStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err := Generate(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	issued, err := ca.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := store.Load("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded == nil {
+		t.Fatal("certificate not stored")
+	}
+	if !loaded.Leaf.Equal(issued.Leaf) || len(loaded.Certificate) != len(issued.Certificate) {
+		t.Error("loaded certificate differs from the issued one")
+	}
+	if _, err := tls.X509KeyPair(pemChain(issued), mustKeyPEM(t, loaded)); err != nil {
+		t.Errorf("loaded key does not match: %v", err)
+	}
+
+	// Another authority with the same store finds the certificate, but
+	// issues its own since it did not sign it.
+	other, err := Generate(store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reissued, err := other.Certificate("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reissued.Leaf.CheckSignatureFrom(other.cert) != nil {
+		t.Error("certificate of another CA reused")
+	}
+
+	missing, err := store.Load("missing.example.com")
+	if err != nil || missing != nil {
+		t.Errorf("Load(missing) = %v, %v, want nil, nil", missing, err)
+	}
+}
+
+func TestDirStorePath(t *testing.T) {
+	store := &DirStore{dir: "/certs"}
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "/certs/example.com.pem"},
+		{"::1", "/certs/__1.pem"},
+		{"../../etc/passwd", "/certs/.._.._etc_passwd.pem"},
+		{`..\windows`, "/certs/.._windows.pem"},
+	}
+
+	for _, tt := range tests {
+		if got := store.path(tt.host); got != tt.want {
+			t.Errorf("path(%q) = %q, want %q", tt.host, got, tt.want)
+		}
+		if filepath.Dir(store.path(tt.host)) != "/certs" {
+			t.Errorf("path(%q) leaves the store", tt.host)
+		}
+	}
+}
+
+func mustParse(t *testing.T, der []byte) *x509.Certificate {
+	t.Helper()
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func pemChain(cert *tls.Certificate) []byte {
+	var data []byte
+	for _, der := range cert.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	return data
+}
+
+func mustKeyPEM(t *testing.T, cert *tls.Certificate) []byte {
+	t.Helper()
+	key, err := encodePrivateKey(cert.PrivateKey.(crypto.Signer))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
@@ -0,0 +1,81 @@
+package ca
+
+import (
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Store persists issued certificates between runs.
+type Store interface {
+	// Load returns nil without an error if no certificate is stored.
+	Load(host string) (*tls.Certificate, error)
+	Save(host string, cert *tls.Certificate) error
+}
+
+// DirStore keeps one PEM file with the certificate chain and key per host.
+type DirStore struct {
+	dir string
+}
+
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create certificate store: %w", err)
+	}
+	return &DirStore{dir: dir}, nil
+}
+
+func (s *DirStore) Load(host string) (*tls.Certificate, error) {
+	data, err := os.ReadFile(s.path(host))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.X509KeyPair(data, data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate for %s: %w", host, err)
+	}
+
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &cert, nil
+}
+
+func (s *DirStore) Save(host string, cert *tls.Certificate) error {
+	signer, ok := cert.PrivateKey.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("unsupported private key type %T", cert.PrivateKey)
+	}
+
+	keyPEM, err := encodePrivateKey(signer)
+	if err != nil {
+		return err
+	}
+
+	var data []byte
+	for _, der := range cert.Certificate {
+		data = append(data, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})...)
+	}
+	data = append(data, keyPEM...)
+
+	return os.WriteFile(s.path(host), data, 0o600)
+}
+
+func (s *DirStore) path(host string) string {
+	name := strings.NewReplacer(":", "_", "/", "_", "\\", "_").Replace(host)
+	return filepath.Join(s.dir, name+".pem")
+}
@@ -0,0 +1,254 @@
+package cmdi
+
+import (
+	"fmt"
+	"time"
+
+	"http-proxy/pkg/oob"
+	"http-proxy/pkg/scanner"
+)
+
+const (
+	VariantOutput    = "output_based"
+	VariantTime      = "time_based"
+	VariantOutOfBand = "out_of_band"
+)
+
+// kDelay is the delay injected first, kConfirmDelays are injected after it
+// with the same payload. The response times must follow the delays.
+const kDelay = 5
+
+var kConfirmDelays = []int{0, 3, 0, 6}
+
+// kSamples is the number of times the original request is timed.
+const kSamples = 4
+
+// kPoints are the parts of a request which may end up in command lines.
+var kPoints = []scanner.PointKind{scanner.PointQuery, scanner.PointForm, scanner.PointJSON,
+	scanner.PointCookie, scanner.PointMultipart}
+
+type check struct{}
+
+// NewCheck returns the check which chains shell commands to parameters.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "cmdi"
+}
+
+type scan struct {
+	t *scanner.Target
+	// mean and deviation are the response times of the original request in
+	// seconds, measured before the first time based payload.
+	timed           bool
+	mean, deviation float64
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scan{t: t}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		if point.Filename != "" {
+			continue
+		}
+
+		// Each technique is tried only if the previous ones found nothing,
+		// the slowest comes last, so a point is reported at most once.
+		for _, technique := range []func(*scanner.InsertionPoint) (*scanner.Finding, error){
+			s.outputBased, s.outOfBand, s.timeBased,
+		} {
+			finding, err := technique(point)
+			if err != nil {
+				return findings, err
+			}
+			if finding != nil {
+				findings = append(findings, *finding)
+				break
+			}
+		}
+	}
+	return findings, nil
+}
+
+// outputBased echoes a token, which the response shows if it includes the
+// output of the command.
+func (s *scan) outputBased(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	token := scanner.Token()
+
+	for _, c := range kChainings {
+		payload := c.payload(point.Value, echo(token), windowsEcho(token))
+		resp, err := s.send(point, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if evidence := scanner.Evidence(resp.Body, []byte(token)); evidence != "" {
+			return s.finding(point, resp, VariantOutput, scanner.ConfidenceCertain, payload, evidence,
+				"output of the injected command, "+c.String()), nil
+		}
+	}
+	return nil, nil
+}
+
+// outOfBand makes the injected command call back, with a payload per
+// separator to tell which one ran.
+func (s *scan) outOfBand(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	var callbacks []oob.Payload
+	type injection struct {
+		chaining chaining
+		payload  string
+		resp     *scanner.Response
+	}
+	injections := make(map[string]injection)
+
+	for _, c := range kChainings {
+		callback, ok := s.t.Callback(VariantOutOfBand, point.String())
+		if !ok {
+			return nil, nil
+		}
+
+		payload := c.payload(point.Value, callbackCommand(callback.URL, callback.Domain), windowsCallback(callback.Domain))
+		resp, err := s.send(point, payload)
+		if err != nil {
+			return nil, err
+		}
+		s.t.Attach(callback, resp)
+		callbacks = append(callbacks, callback)
+		injections[callback.Token] = injection{c, payload, resp}
+	}
+
+	records := s.t.AwaitCallbacks(callbacks)
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	record := records[0]
+	interaction := record.Interactions[0]
+	by := injections[record.Token]
+	return s.finding(point, by.resp, VariantOutOfBand, scanner.ConfidenceCertain, by.payload, interaction.Detail,
+		fmt.Sprintf("%s interaction from %s, token %s, %s", interaction.Protocol, interaction.RemoteAddr, record.Token, by.chaining)), nil
+}
+
+// timeBased injects sleeps. A payload which holds up the response by the
+// delay is sent again with other delays, and the response times must grow
+// linearly with the delay, so that a slow server is not taken for one
+// which sleeps.
+func (s *scan) timeBased(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	stable, err := s.stableBaseline()
+	if err != nil || !stable {
+		return nil, err
+	}
+
+	for _, c := range kChainings {
+		resp, err := s.send(point, c.payload(point.Value, sleep(kDelay), windowsSleep(kDelay)))
+		if err != nil {
+			return nil, err
+		}
+		if seconds(resp) < s.mean+0.9*kDelay {
+			continue
+		}
+
+		delays, elapsed := []float64{kDelay}, []float64{seconds(resp)}
+		var payload string
+		for _, delay := range kConfirmDelays {
+			payload = c.payload(point.Value, sleep(delay), windowsSleep(delay))
+			if resp, err = s.send(point, payload); err != nil {
+				return nil, err
+			}
+			delays = append(delays, float64(delay))
+			elapsed = append(elapsed, seconds(resp))
+		}
+
+		slope, correlation := fit(delays, elapsed)
+		if slope >= 0.8 && slope <= 1.5 && correlation >= 0.95 {
+			evidence := fmt.Sprintf("response times %s for delays of %v seconds, %.3fs without a payload",
+				formatSeconds(elapsed), delays, s.mean)
+			return s.finding(point, resp, VariantTime, scanner.ConfidenceFirm, payload, evidence,
+				fmt.Sprintf("response time follows the delay with slope %.2f and correlation %.2f, %s", slope, correlation, c)), nil
+		}
+	}
+	return nil, nil
+}
+
+// stableBaseline reports whether the original request responds fast and
+// steadily enough for an injected delay to stand out. Otherwise no time based
+// payloads are sent at all.
+func (s *scan) stableBaseline() (bool, error) {
+	if err := s.time(); err != nil {
+		return false, err
+	}
+	return s.mean+3*s.deviation < kDelay/2.0, nil
+}
+
+// time measures the response time of the original request once.
+func (s *scan) time() error {
+	if s.timed {
+		return nil
+	}
+
+	baseline, err := s.t.Baseline()
+	if err != nil {
+		return err
+	}
+	samples := []float64{seconds(baseline)}
+
+	for len(samples) < kSamples {
+		req, err := s.t.Request()
+		if err != nil {
+			return err
+		}
+		resp, err := s.t.Send(req)
+		if err != nil {
+			return err
+		}
+		samples = append(samples, seconds(resp))
+	}
+
+	s.mean, s.deviation = meanDeviation(samples)
+	s.timed = true
+	return nil
+}
+
+func seconds(resp *scanner.Response) float64 {
+	return resp.Elapsed.Seconds()
+}
+
+func formatSeconds(samples []float64) []string {
+	formatted := make([]string, len(samples))
+	for i, sample := range samples {
+		formatted[i] = time.Duration(sample * float64(time.Second)).Round(time.Millisecond).String()
+	}
+	return formatted
+}
+
+func (s *scan) send(point *scanner.InsertionPoint, value string) (*scanner.Response, error) {
+	req, err := s.t.Inject(point, value)
+	if err != nil {
+		return nil, err
+	}
+	return s.t.Send(req)
+}
+
+func (s *scan) finding(point *scanner.InsertionPoint, resp *scanner.Response,
+	variant string, confidence scanner.Confidence, payload, evidence, detail string) *scanner.Finding {
+	return &scanner.Finding{
+		Name:           "OS command injection",
+		Severity:       scanner.SeverityHigh,
+		Confidence:     confidence,
+		Variant:        variant,
+		InsertionPoint: point.String(),
+		Payload:        payload,
+		Evidence:       evidence,
+		Detail:         detail,
+		RequestID:      resp.RequestID,
+		ResponseID:     resp.ResponseID,
+	}
+}
@@ -0,0 +1,129 @@
+package cmdi
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+// shell pretends to run "echo <q>" through a shell, which only knows the ;
+// separator. Sleeps are simulated through the delay header.
+type shell struct {
+	// output shows the output of the commands.
+	output bool
+	// vulnerable runs injected commands, safe servers echo q as is.
+	vulnerable bool
+	// jitter delays every other request without a payload by two seconds.
+	jitter bool
+
+	requests atomic.Int64
+}
+
+func (s *shell) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	n := s.requests.Add(1)
+
+	out, delay := "", 0
+	if !s.vulnerable {
+		out = q
+	} else {
+		for _, command := range strings.Split("echo "+q, ";") {
+			name, arg, _ := strings.Cut(strings.TrimSpace(command), " ")
+			switch name {
+			case "echo":
+				out += strings.ReplaceAll(arg, `\`, "") + "\n"
+			case "sleep":
+				seconds, _ := strconv.Atoi(arg)
+				delay += seconds
+			}
+		}
+	}
+	if s.jitter && q == "x" && n%2 == 0 {
+		delay += 2
+	}
+
+	w.Header().Set(scannertest.DelayHeader, strconv.Itoa(delay))
+	if s.output {
+		fmt.Fprint(w, "result: "+out)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *shell
+		wantVariant string
+		// wantSleeps tells whether time based payloads are sent.
+		wantSleeps bool
+	}{
+		{name: "output", server: &shell{output: true, vulnerable: true}, wantVariant: VariantOutput},
+		{name: "blind", server: &shell{vulnerable: true}, wantVariant: VariantTime, wantSleeps: true},
+		{name: "reflected", server: &shell{output: true}, wantSleeps: true},
+		{name: "unstable", server: &shell{output: true, jitter: true}},
+		{name: "blind unstable", server: &shell{vulnerable: true, jitter: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			target, client := scannertest.NewTarget(http.MethodGet, server.URL+"/?q=x", nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:q" {
+				t.Errorf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+
+			sleeps := 0
+			for _, sent := range client.Sent() {
+				if strings.Contains(sent.URI, "sleep") {
+					sleeps++
+				}
+			}
+			if (sleeps != 0) != tt.wantSleeps {
+				t.Errorf("sent %d time based payloads", sleeps)
+			}
+		})
+	}
+}
+
+func TestFirstTechniqueWins(t *testing.T) {
+	server := httptest.NewServer(&shell{output: true, vulnerable: true})
+	defer server.Close()
+
+	target, client := scannertest.NewTarget(http.MethodGet, server.URL+"/?q=x&other=y", nil, "", nil)
+	if _, err := NewCheck().Scan(target); err != nil {
+		t.Fatal(err)
+	}
+
+	// The output of the first payload confirms q, no other technique is
+	// tried on it.
+	payloads := 0
+	for _, sent := range client.Sent() {
+		query, err := url.ParseQuery(strings.TrimPrefix(sent.URI, "/?"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if query.Get("q") != "x" {
+			payloads++
+		}
+	}
+	if payloads != 1 {
+		t.Errorf("sent %d payloads to q, want 1", payloads)
+	}
+}
@@ -0,0 +1,140 @@
+// Package cmdi finds OS command injection through the output of injected
+// commands, delays and out-of-band callbacks.
+package cmdi
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// separator chains an injected command to the one the value is passed to.
+type separator struct {
+	name string
+	wrap func(command string) string
+	// windows is set for separators of cmd.exe only.
+	windows bool
+}
+
+var kSeparators = []separator{
+	{name: ";", wrap: func(c string) string { return ";" + c + ";" }},
+	{name: "|", wrap: func(c string) string { return "|" + c }},
+	{name: "&&", wrap: func(c string) string { return "&&" + c + "&&" }},
+	{name: "`", wrap: func(c string) string { return "`" + c + "`" }},
+	{name: "$()", wrap: func(c string) string { return "$(" + c + ")" }},
+	{name: "newline", wrap: func(c string) string { return "\n" + c + "\n" }},
+	{name: "&", wrap: func(c string) string { return "&" + c + "&" }, windows: true},
+}
+
+// kQuotes close the quotes which may surround the value in the command line,
+// the injected command is followed by the same quote to balance the rest.
+var kQuotes = []string{"", "'", `"`}
+
+// chaining is a separator inside a quote.
+type chaining struct {
+	separator separator
+	quote     string
+}
+
+// kChainings are all separators inside all quotes, single quotes do not
+// apply to cmd.exe.
+var kChainings = func() []chaining {
+	var chainings []chaining
+	for _, quote := range kQuotes {
+		for _, sep := range kSeparators {
+			if !sep.windows || quote != "'" {
+				chainings = append(chainings, chaining{sep, quote})
+			}
+		}
+	}
+	return chainings
+}()
+
+// payload returns value with the command chained, windowsCommand after
+// Windows separators.
+func (c chaining) payload(value, command, windowsCommand string) string {
+	if c.separator.windows {
+		command = windowsCommand
+	}
+	return value + c.quote + c.separator.wrap(command) + c.quote
+}
+
+// String tells how the command is chained.
+func (c chaining) String() string {
+	s := c.separator.name + " separator"
+	if c.quote != "" {
+		s += " after closing " + c.quote
+	}
+	return s
+}
+
+// echo prints token, which is split by a backslash in the payload. The
+// shell removes it only from unquoted words, so a value reflected as is or
+// echoed inside quotes does not show the token.
+func echo(token string) string {
+	return fmt.Sprintf(`echo %s\%s`, token[:len(token)/2], token[len(token)/2:])
+}
+
+// windowsEcho prints token, which is split by a caret in the payload.
+func windowsEcho(token string) string {
+	return fmt.Sprintf("echo %s^%s", token[:len(token)/2], token[len(token)/2:])
+}
+
+func sleep(seconds int) string {
+	return fmt.Sprintf("sleep %d", seconds)
+}
+
+// windowsSleep waits one second between pings.
+func windowsSleep(seconds int) string {
+	return fmt.Sprintf("ping -n %d 127.0.0.1", seconds+1)
+}
+
+// callbackCommand fetches url and resolves domain with whichever tool exists.
+func callbackCommand(url, domain string) string {
+	return strings.Join([]string{
+		"curl -s " + url,
+		"wget -q -O- " + url,
+		"nslookup " + domain,
+	}, ";")
+}
+
+func windowsCallback(domain string) string {
+	return "nslookup " + domain
+}
+
+// fit returns the slope of the least squares line through the points and
+// the correlation coefficient of x and y.
+func fit(x, y []float64) (slope, correlation float64) {
+	n := float64(len(x))
+	var sumX, sumY float64
+	for i := range x {
+		sumX += x[i]
+		sumY += y[i]
+	}
+	meanX, meanY := sumX/n, sumY/n
+
+	var covariance, varianceX, varianceY float64
+	for i := range x {
+		dx, dy := x[i]-meanX, y[i]-meanY
+		covariance += dx * dy
+		varianceX += dx * dx
+		varianceY += dy * dy
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return 0, 0
+	}
+	return covariance / varianceX, covariance / math.Sqrt(varianceX*varianceY)
+}
+
+// meanDeviation returns the mean and the standard deviation of samples.
+func meanDeviation(samples []float64) (mean, deviation float64) {
+	for _, sample := range samples {
+		mean += sample
+	}
+	mean /= float64(len(samples))
+
+	for _, sample := range samples {
+		deviation += (sample - mean) * (sample - mean)
+	}
+	return mean, math.Sqrt(deviation / float64(len(samples)))
+}
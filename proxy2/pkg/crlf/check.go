@@ -0,0 +1,122 @@
+package crlf
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"slices"
+
+	"http-proxy/pkg/scanner"
+)
+
+// kPoints are the parts of a request which servers copy into headers.
+var kPoints = []scanner.PointKind{scanner.PointQuery, scanner.PointForm, scanner.PointPath,
+	scanner.PointCookie, scanner.PointHeader}
+
+type check struct{}
+
+// NewCheck returns the check which injects line breaks into parameters,
+// path segments, cookies and headers.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "crlf"
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		finding, err := scanPoint(t, point)
+		if err != nil {
+			return findings, err
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// scanPoint tries each line break, first to add a header, then to end the
+// headers and start the body with a token.
+func scanPoint(t *scanner.Target, point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	token := scanner.Token()
+	name, line := header(token)
+	value := encode(point)
+
+	lineBreaks := kLineBreaks
+	if point.Kind == scanner.PointHeader {
+		lineBreaks = append(slices.Clip(lineBreaks), kRawLineBreaks...)
+	}
+
+	for _, lb := range lineBreaks {
+		payload := value + lb.sequence + line
+		resp, err := send(t, point, payload)
+		if err != nil {
+			return nil, err
+		}
+
+		if resp.Header.Get(name) == token {
+			return &scanner.Finding{
+				Name:           "HTTP response header injection",
+				Severity:       scanner.SeverityMedium,
+				Confidence:     scanner.ConfidenceCertain,
+				Variant:        lb.variant,
+				InsertionPoint: point.String(),
+				Payload:        payload,
+				Evidence:       line,
+				Detail:         "injected header " + name,
+				RequestID:      resp.RequestID,
+				ResponseID:     resp.ResponseID,
+			}, nil
+		}
+
+		payload = value + lb.sequence + lb.sequence + token
+		if resp, err = send(t, point, payload); err != nil {
+			return nil, err
+		}
+
+		if bytes.HasPrefix(resp.Body, []byte(token)) {
+			return &scanner.Finding{
+				Name:           "HTTP response splitting",
+				Severity:       scanner.SeverityHigh,
+				Confidence:     scanner.ConfidenceFirm,
+				Variant:        lb.variant,
+				InsertionPoint: point.String(),
+				Payload:        payload,
+				Evidence:       scanner.Excerpt(resp.Body, 0, len(token)),
+				Detail:         fmt.Sprintf("headers ended by the injected line breaks, body starts with %s", token),
+				RequestID:      resp.RequestID,
+				ResponseID:     resp.ResponseID,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// encode returns the original value of the point encoded for raw insertion,
+// so that the payload follows a value the server accepts.
+func encode(point *scanner.InsertionPoint) string {
+	switch point.Kind {
+	case scanner.PointHeader:
+		return point.Value
+	case scanner.PointPath:
+		return url.PathEscape(point.Value)
+	}
+	return url.QueryEscape(point.Value)
+}
+
+func send(t *scanner.Target, point *scanner.InsertionPoint, payload string) (*scanner.Response, error) {
+	req, err := t.InjectRaw(point, payload)
+	if err != nil {
+		return nil, err
+	}
+	return t.Send(req)
+}
@@ -0,0 +1,90 @@
+package crlf
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+// redirect redirects to the next parameter, or back to the Referer if there
+// is none, decoding it first.
+type redirect struct {
+	// raw writes the header without the line breaks net/http filters out.
+	raw bool
+}
+
+func (s *redirect) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	location := "/" + r.URL.Query().Get("next")
+	if !r.URL.Query().Has("next") {
+		location, _ = url.PathUnescape(r.Referer())
+	}
+	if !s.raw {
+		http.Redirect(w, r, location, http.StatusFound)
+		return
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		panic(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprintf(buf, "HTTP/1.1 302 Found\r\nLocation: %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", location)
+	buf.Flush()
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		server    *redirect
+		target    string
+		wantPoint string
+	}{
+		{name: "parameter", server: &redirect{raw: true}, target: "/?next=home", wantPoint: "query:next"},
+		{name: "parameter filtered", server: &redirect{}, target: "/?next=home"},
+		{name: "header", server: &redirect{raw: true}, target: "/", wantPoint: "header:Referer"},
+		{name: "header filtered", server: &redirect{}, target: "/"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			header := http.Header{"Referer": {"http://example.com/"}}
+			target, client := scannertest.NewTarget(http.MethodGet, server.URL+tt.target, header, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantPoint == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != VariantCRLF || findings[0].InsertionPoint != tt.wantPoint {
+				t.Errorf("findings = %+v, want one crlf finding in %s", findings, tt.wantPoint)
+			}
+			if tt.wantPoint != "" {
+				return
+			}
+
+			// Without a finding every line break is tried in the header,
+			// the raw ones unencoded.
+			raw := 0
+			for _, sent := range client.Sent() {
+				if strings.Contains(sent.Header.Get("Referer"), "\n") {
+					raw++
+				}
+			}
+			if raw != 2*len(kRawLineBreaks) {
+				t.Errorf("sent %d raw line breaks in the header", raw)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Package crlf finds CRLF injection into response headers, which adds
+// headers or splits the response, by putting encoded line breaks into
+// values which the server copies into headers, e.g. redirects and cookies.
+package crlf
+
+const (
+	VariantCRLF          = "crlf"
+	VariantLF            = "lf"
+	VariantCR            = "cr"
+	VariantDoubleEncoded = "double_encoded"
+	VariantUTF8          = "utf8_truncation"
+	VariantRawCRLF       = "raw_crlf"
+	VariantRawLF         = "raw_lf"
+)
+
+// lineBreak is an encoded line break. Payloads are inserted raw, request
+// headers keep them encoded as well, for servers which decode header values,
+// e.g. a Referer they redirect back to.
+type lineBreak struct {
+	variant  string
+	sequence string
+}
+
+var kLineBreaks = []lineBreak{
+	{VariantCRLF, "%0d%0a"},
+	{VariantLF, "%0a"},
+	{VariantCR, "%0d"},
+	{VariantDoubleEncoded, "%250d%250a"},
+	// U+560A and U+560D become LF and CR in servers which truncate
+	// characters to bytes.
+	{VariantUTF8, "%E5%98%8A%E5%98%8D"},
+}
+
+// kRawLineBreaks are only sent in request headers, unencoded, for servers
+// and proxies which keep line breaks within header values.
+var kRawLineBreaks = []lineBreak{
+	{VariantRawCRLF, "\r\n"},
+	{VariantRawLF, "\n"},
+}
+
+// header is an injected header named and valued by token, without spaces
+// so that it needs no encoding.
+func header(token string) (name, line string) {
+	name = "X-" + token
+	return name, name + ":" + token
+}
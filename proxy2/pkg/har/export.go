@@ -0,0 +1,261 @@
+package har
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"http-proxy/repo"
+)
+
+const defaultHTTPVersion = "HTTP/1.1"
+
+// NewEntry converts a stored exchange. resp is nil if the request was never
+// answered, which is exported as status 0.
+func NewEntry(req *repo.RequestData, resp *repo.ResponseData) *Entry {
+	entry := &Entry{
+		StartedDateTime: req.Timestamp.Time().Format(time.RFC3339Nano),
+		Request:         newRequest(req),
+		Response:        &Response{Cookies: []Cookie{}, Headers: []NameValue{}, HeadersSize: -1, BodySize: -1},
+		Timings:         Timings{Blocked: -1, DNS: -1, Connect: -1, SSL: -1},
+	}
+
+	if resp == nil {
+		return entry
+	}
+	entry.Response = newResponse(resp)
+
+	if t := resp.Timings; t != nil {
+		entry.StartedDateTime = t.Started.Time().Format(time.RFC3339Nano)
+		entry.Timings.Connect = t.Connect
+		entry.Timings.Send = t.Send
+		entry.Timings.Wait = t.Wait
+		entry.Timings.Receive = t.Receive
+	}
+	entry.Time = entry.Timings.total()
+
+	return entry
+}
+
+func (t *Timings) total() float64 {
+	var total float64
+	for _, phase := range []float64{t.Blocked, t.DNS, t.Connect, t.Send, t.Wait, t.Receive} {
+		if phase > 0 {
+			total += phase
+		}
+	}
+	return total
+}
+
+func newRequest(data *repo.RequestData) *Request {
+	header := data.Header()
+	target, query := requestURL(data)
+
+	req := &Request{
+		Method:      data.Method,
+		URL:         target,
+		HTTPVersion: httpVersion(data.Raw, false),
+		Cookies:     requestCookies(data.Cookies),
+		Headers:     nameValues(header),
+		QueryString: query,
+		HeadersSize: headersSize(data.Raw),
+		BodySize:    data.BodySize,
+	}
+
+	if len(data.Body) != 0 || len(data.PostParams) != 0 {
+		req.PostData = newPostData(data, header.Get("Content-Type"))
+	}
+
+	return req
+}
+
+// requestURL takes the URL and the query from the raw request line, since
+// the parsed query loses the order and the escaping of the parameters.
+func requestURL(data *repo.RequestData) (string, []NameValue) {
+	line, _, found := bytes.Cut(data.Raw, []byte("\r\n"))
+	fields := strings.Fields(string(line))
+	if !found || len(fields) != 3 {
+		u := url.URL{
+			Scheme:   data.Scheme,
+			Host:     data.Host,
+			Path:     data.Path,
+			RawQuery: data.Query().Encode(),
+		}
+		return u.String(), nameValues(data.Query())
+	}
+
+	target := fields[1]
+	if strings.HasPrefix(target, "/") {
+		target = data.Scheme + "://" + data.Host + target
+	}
+
+	query := []NameValue{}
+	if _, rawQuery, found := strings.Cut(target, "?"); found {
+		for _, pair := range strings.Split(rawQuery, "&") {
+			if pair == "" {
+				continue
+			}
+			name, value, _ := strings.Cut(pair, "=")
+			query = append(query, NameValue{Name: unescapeQuery(name), Value: unescapeQuery(value)})
+		}
+	}
+
+	return target, query
+}
+
+// unescapeQuery decodes a query component, keeping it as it is if it is not
+// escaped properly.
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+func newPostData(data *repo.RequestData, contentType string) *PostData {
+	text, encoding := repo.EncodeBody(data.Body, contentType)
+
+	postData := &PostData{
+		MimeType: contentType,
+		Params:   []Param{},
+		Text:     text,
+	}
+	if encoding == repo.BodyEncodingBase64 {
+		postData.Encoding = encoding
+	}
+
+	for _, param := range nameValues(data.Form()) {
+		postData.Params = append(postData.Params, Param{Name: param.Name, Value: param.Value})
+	}
+
+	return postData
+}
+
+func newResponse(data *repo.ResponseData) *Response {
+	header := data.Header()
+	contentType := header.Get("Content-Type")
+
+	return &Response{
+		Status:      data.Code,
+		StatusText:  data.Message,
+		HTTPVersion: httpVersion(data.Raw, true),
+		Cookies:     responseCookies(header),
+		Headers:     nameValues(header),
+		Content:     newContent(data, contentType),
+		RedirectURL: header.Get("Location"),
+		HeadersSize: headersSize(data.Raw),
+		BodySize:    data.EncodedSize,
+	}
+}
+
+// newContent exports the decoded body, compression is the difference to the
+// size on the wire.
+func newContent(data *repo.ResponseData, contentType string) Content {
+	text, encoding := repo.EncodeBody(data.Body, contentType)
+
+	content := Content{
+		Size:     data.DecodedSize,
+		MimeType: contentType,
+		Text:     text,
+	}
+	if encoding == repo.BodyEncodingBase64 {
+		content.Encoding = encoding
+	}
+	if data.Encoding != "" && data.DecodeError == "" {
+		content.Compression = data.DecodedSize - data.EncodedSize
+	}
+
+	switch {
+	case data.Truncated:
+		content.Comment = fmt.Sprintf("body truncated to %d bytes", len(data.Body))
+	case data.DecodeError != "":
+		content.Comment = "body not decoded: " + data.DecodeError
+	}
+
+	return content
+}
+
+// nameValues flattens the values sorted by name, keeping the order of the
+// values of a name.
+func nameValues(values map[string][]string) []NameValue {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]NameValue, 0, len(values))
+	for _, name := range names {
+		for _, value := range values[name] {
+			res = append(res, NameValue{Name: name, Value: value})
+		}
+	}
+	return res
+}
+
+func requestCookies(cookies map[string]string) []Cookie {
+	res := make([]Cookie, 0, len(cookies))
+	for name, value := range cookies {
+		res = append(res, Cookie{Name: name, Value: value})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res
+}
+
+func responseCookies(header http.Header) []Cookie {
+	cookies := (&http.Response{Header: header}).Cookies()
+
+	res := make([]Cookie, 0, len(cookies))
+	for _, cookie := range cookies {
+		c := Cookie{
+			Name:     cookie.Name,
+			Value:    cookie.Value,
+			Path:     cookie.Path,
+			Domain:   cookie.Domain,
+			HTTPOnly: cookie.HttpOnly,
+			Secure:   cookie.Secure,
+		}
+		if !cookie.Expires.IsZero() {
+			c.Expires = cookie.Expires.Format(time.RFC3339)
+		}
+		res = append(res, c)
+	}
+	return res
+}
+
+// httpVersion reads the version from the first line of the raw message,
+// which ends a request line and starts a status line.
+func httpVersion(raw []byte, response bool) string {
+	line, _, found := bytes.Cut(raw, []byte("\r\n"))
+	if !found {
+		return defaultHTTPVersion
+	}
+
+	fields := strings.Fields(string(line))
+	if len(fields) < 2 {
+		return defaultHTTPVersion
+	}
+
+	version := fields[len(fields)-1]
+	if response {
+		version = fields[0]
+	}
+	if !strings.HasPrefix(version, "HTTP/") {
+		return defaultHTTPVersion
+	}
+	return version
+}
+
+// headersSize counts the raw message up to and including the empty line
+// after the headers, -1 if it is not known.
+func headersSize(raw []byte) int64 {
+	end := bytes.Index(raw, []byte("\r\n\r\n"))
+	if end == -1 {
+		return -1
+	}
+	return int64(end + 4)
+}
@@ -0,0 +1,104 @@
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"slices"
+	"testing"
+
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestRequestURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		raw       string
+		getParams bson.M
+		wantURL   string
+		wantQuery []NameValue
+	}{
+		{
+			name:    "origin form",
+			raw:     "GET /search?q=a%20b&a=1&q=c HTTP/1.1\r\nHost: example.com\r\n\r\n",
+			wantURL: "https://example.com/search?q=a%20b&a=1&q=c",
+			wantQuery: []NameValue{
+				{Name: "q", Value: "a b"},
+				{Name: "a", Value: "1"},
+				{Name: "q", Value: "c"},
+			},
+		},
+		{
+			name:      "absolute form",
+			raw:       "GET http://other.example/x?b=%2F&flag HTTP/1.1\r\n\r\n",
+			wantURL:   "http://other.example/x?b=%2F&flag",
+			wantQuery: []NameValue{{Name: "b", Value: "/"}, {Name: "flag", Value: ""}},
+		},
+		{
+			name:      "bad escape",
+			raw:       "GET /?x=%zz HTTP/1.1\r\n\r\n",
+			wantURL:   "https://example.com/?x=%zz",
+			wantQuery: []NameValue{{Name: "x", Value: "%zz"}},
+		},
+		{
+			name:      "no raw message",
+			getParams: bson.M{"b": bson.A{"2"}, "a": bson.A{"1"}},
+			wantURL:   "https://example.com/search?a=1&b=2",
+			wantQuery: []NameValue{{Name: "a", Value: "1"}, {Name: "b", Value: "2"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := &repo.RequestData{
+				Scheme:    "https",
+				Host:      "example.com",
+				Path:      "/search",
+				GetParams: tt.getParams,
+				Raw:       []byte(tt.raw),
+			}
+
+			gotURL, gotQuery := requestURL(data)
+			if gotURL != tt.wantURL {
+				t.Errorf("URL = %q, want %q", gotURL, tt.wantURL)
+			}
+			if !slices.Equal(gotQuery, tt.wantQuery) {
+				t.Errorf("query = %v, want %v", gotQuery, tt.wantQuery)
+			}
+		})
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	for _, count := range []int{0, 1, 3} {
+		var buf bytes.Buffer
+		encoder := NewEncoder(&buf)
+		for i := 0; i < count; i++ {
+			entry := &Entry{Request: &Request{Method: "GET", URL: "http://example.com/<" + string(rune('a'+i)) + ">"}}
+			if err := encoder.Encode(entry); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := encoder.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		archive := &HAR{}
+		if err := json.Unmarshal(buf.Bytes(), archive); err != nil {
+			t.Fatalf("%d entries: invalid archive %q: %v", count, buf.String(), err)
+		}
+		if archive.Log.Version != Version || archive.Log.Creator.Name != CreatorName {
+			t.Errorf("%d entries: log = %+v", count, archive.Log)
+		}
+		if len(archive.Log.Entries) != count {
+			t.Errorf("%d entries: decoded %d", count, len(archive.Log.Entries))
+		}
+		if count == 0 && archive.Log.Entries == nil {
+			t.Error("no entries list for an empty archive")
+		}
+		if bytes.Contains(buf.Bytes(), []byte(`\u003c`)) {
+			t.Error("HTML escaped in the archive")
+		}
+	}
+}
@@ -0,0 +1,187 @@
+// Package har implements the HTTP Archive format 1.2 used to exchange traffic
+// with browsers and other tools, see http://www.softwareishard.com/blog/har-12-spec/.
+package har
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+)
+
+const (
+	Version        = "1.2"
+	CreatorName    = "http-proxy"
+	CreatorVersion = "1.0"
+)
+
+type HAR struct {
+	Log Log `json:"log"`
+}
+
+type Log struct {
+	Version string   `json:"version"`
+	Creator Creator  `json:"creator"`
+	Entries []*Entry `json:"entries"`
+	Comment string   `json:"comment,omitempty"`
+}
+
+type Creator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type Entry struct {
+	StartedDateTime string    `json:"startedDateTime"`
+	Time            float64   `json:"time"`
+	Request         *Request  `json:"request"`
+	Response        *Response `json:"response"`
+	Cache           Cache     `json:"cache"`
+	Timings         Timings   `json:"timings"`
+	ServerIPAddress string    `json:"serverIPAddress,omitempty"`
+	Comment         string    `json:"comment,omitempty"`
+}
+
+type Request struct {
+	Method      string      `json:"method"`
+	URL         string      `json:"url"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	QueryString []NameValue `json:"queryString"`
+	PostData    *PostData   `json:"postData,omitempty"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Response struct {
+	Status      int         `json:"status"`
+	StatusText  string      `json:"statusText"`
+	HTTPVersion string      `json:"httpVersion"`
+	Cookies     []Cookie    `json:"cookies"`
+	Headers     []NameValue `json:"headers"`
+	Content     Content     `json:"content"`
+	RedirectURL string      `json:"redirectURL"`
+	HeadersSize int64       `json:"headersSize"`
+	BodySize    int64       `json:"bodySize"`
+}
+
+type Cookie struct {
+	Name     string `json:"name"`
+	Value    string `json:"value"`
+	Path     string `json:"path,omitempty"`
+	Domain   string `json:"domain,omitempty"`
+	Expires  string `json:"expires,omitempty"`
+	HTTPOnly bool   `json:"httpOnly,omitempty"`
+	Secure   bool   `json:"secure,omitempty"`
+}
+
+type NameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type PostData struct {
+	MimeType string  `json:"mimeType"`
+	Params   []Param `json:"params"`
+	Text     string  `json:"text"`
+	// Encoding is not part of HAR 1.2, but several tools write base64 for
+	// binary bodies the same way as in Content.
+	Encoding string `json:"encoding,omitempty"`
+}
+
+type Param struct {
+	Name        string `json:"name"`
+	Value       string `json:"value,omitempty"`
+	FileName    string `json:"fileName,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+type Content struct {
+	Size        int64  `json:"size"`
+	Compression int64  `json:"compression,omitempty"`
+	MimeType    string `json:"mimeType"`
+	Text        string `json:"text,omitempty"`
+	Encoding    string `json:"encoding,omitempty"`
+	Comment     string `json:"comment,omitempty"`
+}
+
+type Cache struct{}
+
+// Timings are in milliseconds, -1 marks phases that do not apply.
+type Timings struct {
+	Blocked float64 `json:"blocked"`
+	DNS     float64 `json:"dns"`
+	Connect float64 `json:"connect"`
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+	SSL     float64 `json:"ssl"`
+}
+
+func New(entries []*Entry) *HAR {
+	if entries == nil {
+		entries = []*Entry{}
+	}
+
+	return &HAR{Log: Log{
+		Version: Version,
+		Creator: Creator{Name: CreatorName, Version: CreatorVersion},
+		Entries: entries,
+	}}
+}
+
+// Encoder writes an archive one entry at a time, so that large exports are
+// not held in memory.
+type Encoder struct {
+	w       io.Writer
+	entries *json.Encoder
+	started bool
+	count   int
+}
+
+func NewEncoder(w io.Writer) *Encoder {
+	entries := json.NewEncoder(w)
+	entries.SetEscapeHTML(false)
+	return &Encoder{w: w, entries: entries}
+}
+
+// Encode appends an entry to the archive.
+func (e *Encoder) Encode(entry *Entry) error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	if e.count != 0 {
+		if _, err := e.w.Write([]byte(",")); err != nil {
+			return err
+		}
+	}
+	e.count++
+	return e.entries.Encode(entry)
+}
+
+// Close ends the archive, which must be done even if it has no entries.
+func (e *Encoder) Close() error {
+	if err := e.start(); err != nil {
+		return err
+	}
+	_, err := e.w.Write([]byte("]}}\n"))
+	return err
+}
+
+// start writes the archive up to the opening bracket of the entries.
+func (e *Encoder) start() error {
+	if e.started {
+		return nil
+	}
+	e.started = true
+
+	head, err := json.Marshal(New(nil))
+	if err != nil {
+		return err
+	}
+
+	// The entries are the last field, so the empty list ends the archive.
+	head = head[:bytes.LastIndex(head, []byte("[]"))+1]
+	_, err = e.w.Write(head)
+	return err
+}
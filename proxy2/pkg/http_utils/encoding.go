@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// ContentEncodings returns the codings listed in the Content-Encoding header
+// in the order they were applied, without "identity".
+func ContentEncodings(header http.Header) []string {
+	var res []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, coding := range strings.Split(value, ",") {
+			coding = strings.ToLower(strings.TrimSpace(coding))
+			if coding != "" && coding != "identity" {
+				res = append(res, coding)
+			}
+		}
+	}
+	return res
+}
+
+// ErrDecodedTooLarge is returned by DecodeBody for bodies which decode to
+// more than the limit, e.g. decompression bombs.
+var ErrDecodedTooLarge = errors.New("decoded body exceeds the limit")
+
+// DecodeBody undoes the given content codings, last applied first. No
+// coding is decoded to more than limit bytes.
+func DecodeBody(body []byte, encodings []string, limit int64) ([]byte, error) {
+	for i := len(encodings) - 1; i >= 0; i-- {
+		decoded, err := decode(body, encodings[i], limit)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s failed: %w", encodings[i], err)
+		}
+		body = decoded
+	}
+	return body, nil
+}
+
+func decode(body []byte, encoding string, limit int64) ([]byte, error) {
+	switch encoding {
+	case "gzip", "x-gzip":
+		reader, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader, limit)
+
+	case "deflate":
+		// Servers disagree on whether deflate means zlib or a raw stream.
+		reader, err := zlib.NewReader(bytes.NewReader(body))
+		if err != nil {
+			reader = flate.NewReader(bytes.NewReader(body))
+		}
+		defer reader.Close()
+		return readLimited(reader, limit)
+
+	case "br":
+		return readLimited(brotli.NewReader(bytes.NewReader(body)), limit)
+
+	case "zstd":
+		reader, err := zstd.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		return readLimited(reader, limit)
+
+	default:
+		return nil, fmt.Errorf("unsupported content encoding")
+	}
+}
+
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	decoded, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(decoded)) > limit {
+		return nil, ErrDecodedTooLarge
+	}
+	return decoded, nil
+}
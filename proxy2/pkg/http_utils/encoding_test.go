@@ -0,0 +1,64 @@
+package utils
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+)
+
+func TestDecodeBody(t *testing.T) {
+	plain := bytes.Repeat([]byte("a"), 1000)
+
+	tests := []struct {
+		name      string
+		body      []byte
+		encodings []string
+		limit     int64
+		want      []byte
+		err       error
+	}{
+		{name: "gzip", body: gzipped(plain), encodings: []string{"gzip"}, limit: 1000, want: plain},
+		{name: "brotli", body: brotlied(plain), encodings: []string{"br"}, limit: 1000, want: plain},
+		{name: "stacked", body: brotlied(gzipped(plain)), encodings: []string{"gzip", "br"}, limit: 1000, want: plain},
+		{name: "gzip over limit", body: gzipped(plain), encodings: []string{"gzip"}, limit: 999, err: ErrDecodedTooLarge},
+		{name: "bomb", body: gzipped(make([]byte, 64<<20)), encodings: []string{"gzip"}, limit: 1 << 20, err: ErrDecodedTooLarge},
+		{name: "brotli bomb", body: brotlied(make([]byte, 64<<20)), encodings: []string{"br"}, limit: 1 << 20, err: ErrDecodedTooLarge},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DecodeBody(tt.body, tt.encodings, tt.limit)
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("err = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("decoded %d bytes, want %d", len(got), len(tt.want))
+			}
+		})
+	}
+}
+
+func gzipped(body []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
+
+func brotlied(body []byte) []byte {
+	var buf bytes.Buffer
+	w := brotli.NewWriter(&buf)
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
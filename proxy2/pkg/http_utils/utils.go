@@ -3,7 +3,6 @@ package utils
 import (
 	"bufio"
 	"crypto/tls"
-	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -17,22 +16,25 @@ import (
 const (
 	defaultHTTPPort  = "80"
 	defaultHTTPSPort = "443"
-	DefaultTimeout   = 10 * time.Second
 )
 
-func WriteError(err error, conn net.Conn) error {
+// WriteError answers a proxied request with statusCode, e.g. when the server
+// could not be reached.
+func WriteError(err error, statusCode int, conn net.Conn, timeout time.Duration) error {
+	body := "Proxy error: " + err.Error() + "\n"
 	resp := &http.Response{
-		Status:     http.StatusText(http.StatusInternalServerError),
-		StatusCode: http.StatusInternalServerError,
-		Proto:      "HTTP/1.1",
-		ProtoMajor: 1,
-		ProtoMinor: 1,
-		Header:     make(http.Header),
-		Body:       io.NopCloser(strings.NewReader("Proxy error: " + err.Error() + "\n")),
+		Status:        http.StatusText(statusCode),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
 	}
 	resp.Header.Set("Content-Type", "text/plain")
 
-	return WriteResponse(resp, conn)
+	return WriteResponse(resp, conn, timeout)
 }
 
 func HTTPError(w http.ResponseWriter, message string, statusCode int, err error) {
@@ -63,17 +65,18 @@ func DumpResponse(r *http.Response, includeBody bool) string {
 	return string(dump)
 }
 
-func WriteResponse(resp *http.Response, conn net.Conn) error {
-	if err := conn.SetWriteDeadline(time.Now().Add(DefaultTimeout)); err != nil {
+// WriteResponse, WriteRequest and ReadResponse fail if the message is not
+// transferred within the timeout.
+func WriteResponse(resp *http.Response, conn net.Conn, timeout time.Duration) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
 		return fmt.Errorf("set write deadline failed: %w", err)
 	}
 
-	bytes, err := httputil.DumpResponse(resp, true)
-	if err != nil {
-		return fmt.Errorf("dump response failed: %w", err)
+	writer := bufio.NewWriter(conn)
+	if err := resp.Write(writer); err != nil {
+		return fmt.Errorf("write response failed: %w", err)
 	}
-
-	if _, err := conn.Write(bytes); err != nil {
+	if err := writer.Flush(); err != nil {
 		return fmt.Errorf("write response failed: %w", err)
 	}
 	return nil
@@ -92,25 +95,28 @@ func GetPort(u *url.URL) string {
 	}
 }
 
-func SendRequest(conn net.Conn, req *http.Request) (*http.Response, error) {
-	if err := conn.SetWriteDeadline(time.Now().Add(DefaultTimeout)); err != nil {
-		return nil, fmt.Errorf("set write deadline failed: %w", err)
+func WriteRequest(conn net.Conn, req *http.Request, timeout time.Duration) error {
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return fmt.Errorf("set write deadline failed: %w", err)
 	}
 
-	bytes, err := httputil.DumpRequestOut(req, true)
-	if err != nil {
-		return nil, fmt.Errorf("dump request failed: %w", err)
+	writer := bufio.NewWriter(conn)
+	if err := req.Write(writer); err != nil {
+		return fmt.Errorf("write request failed: %w", err)
 	}
-
-	if _, err := conn.Write(bytes); err != nil {
-		return nil, fmt.Errorf("write request failed: %w", err)
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("write request failed: %w", err)
 	}
 
-	if err := conn.SetReadDeadline(time.Now().Add(DefaultTimeout)); err != nil {
+	return nil
+}
+
+func ReadResponse(conn net.Conn, reader *bufio.Reader, req *http.Request, timeout time.Duration) (*http.Response, error) {
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
 		return nil, fmt.Errorf("set read deadline failed: %w", err)
 	}
 
-	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	resp, err := http.ReadResponse(reader, req)
 	if err != nil {
 		return nil, fmt.Errorf("read response failed: %w", err)
 	}
@@ -118,9 +124,9 @@ func SendRequest(conn net.Conn, req *http.Request) (*http.Response, error) {
 	return resp, nil
 }
 
-func TCPConnect(host, port string) (net.Conn, error) {
+func TCPConnect(host, port string, timeout time.Duration) (net.Conn, error) {
 	dialer := &net.Dialer{
-		Timeout: DefaultTimeout,
+		Timeout: timeout,
 	}
 
 	conn, err := dialer.Dial("tcp", net.JoinHostPort(host, port))
@@ -130,11 +136,13 @@ func TCPConnect(host, port string) (net.Conn, error) {
 	return conn, nil
 }
 
-func TLSConnect(host, port string) (net.Conn, error) {
+// TLSConnect dials host and performs a TLS handshake. serverName overrides
+// the SNI and verified name, which default to host.
+func TLSConnect(host, port, serverName string, timeout time.Duration) (net.Conn, error) {
 	dialer := &tls.Dialer{
-		Config: &tls.Config{},
+		Config: &tls.Config{ServerName: serverName},
 		NetDialer: &net.Dialer{
-			Timeout: DefaultTimeout,
+			Timeout: timeout,
 		},
 	}
 
@@ -145,17 +153,27 @@ func TLSConnect(host, port string) (net.Conn, error) {
 	return conn, nil
 }
 
-func CopyData(dst, src net.Conn) error {
-	if err := dst.SetDeadline(time.Now().Add(DefaultTimeout)); err != nil {
-		return fmt.Errorf("set deadline on dst failed: %w", err)
-	}
-	if err := src.SetDeadline(time.Now().Add(DefaultTimeout)); err != nil {
-		return fmt.Errorf("set deadline on src failed: %w", err)
+type idleTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+}
+
+// WithIdleTimeout returns a connection that extends its deadline before
+// every read and write, so that long transfers only fail when they stall.
+func WithIdleTimeout(conn net.Conn, timeout time.Duration) net.Conn {
+	return &idleTimeoutConn{Conn: conn, timeout: timeout}
+}
+
+func (c *idleTimeoutConn) Read(p []byte) (int, error) {
+	if err := c.Conn.SetReadDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
 	}
+	return c.Conn.Read(p)
+}
 
-	_, err := io.Copy(dst, src)
-	if err != nil && !errors.Is(err, io.EOF) {
-		return fmt.Errorf("copy data failed: %w", err)
+func (c *idleTimeoutConn) Write(p []byte) (int, error) {
+	if err := c.Conn.SetWriteDeadline(time.Now().Add(c.timeout)); err != nil {
+		return 0, err
 	}
-	return nil
+	return c.Conn.Write(p)
 }
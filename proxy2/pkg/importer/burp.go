@@ -0,0 +1,115 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// burpTimeLayout is the Java date format of the time element.
+const burpTimeLayout = "Mon Jan 2 15:04:05 MST 2006"
+
+// burpItems is the file written by "Save items" in Burp Suite.
+type burpItems struct {
+	Items []burpItem `xml:"item"`
+}
+
+type burpItem struct {
+	Time     string      `xml:"time"`
+	URL      string      `xml:"url"`
+	Host     string      `xml:"host"`
+	Port     string      `xml:"port"`
+	Protocol string      `xml:"protocol"`
+	Request  burpMessage `xml:"request"`
+	Response burpMessage `xml:"response"`
+}
+
+type burpMessage struct {
+	Base64 bool   `xml:"base64,attr"`
+	Data   string `xml:",chardata"`
+}
+
+func (m *burpMessage) bytes() ([]byte, error) {
+	if m.Base64 {
+		return base64.StdEncoding.DecodeString(m.Data)
+	}
+	return []byte(m.Data), nil
+}
+
+func readBurp(data []byte) ([]*Exchange, error) {
+	var items burpItems
+	if err := xml.Unmarshal(data, &items); err != nil {
+		return nil, fmt.Errorf("invalid Burp XML: %w", err)
+	}
+
+	exchanges := make([]*Exchange, 0, len(items.Items))
+	for i := range items.Items {
+		exchange, err := burpExchange(&items.Items[i])
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+
+	return exchanges, nil
+}
+
+// burpExchange parses the raw messages, which are stored as sent.
+func burpExchange(item *burpItem) (*Exchange, error) {
+	rawRequest, err := item.Request.bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(rawRequest)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid request: %w", err)
+	}
+
+	req.URL.Scheme = item.Protocol
+	if req.Host == "" {
+		req.Host = burpHost(item)
+	}
+
+	timestamp, err := time.Parse(burpTimeLayout, item.Time)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time: %w", err)
+	}
+
+	exchange := &Exchange{
+		Request:    req,
+		RawRequest: rawRequest,
+		Timestamp:  timestamp,
+	}
+
+	rawResponse, err := item.Response.bytes()
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	if len(rawResponse) == 0 {
+		return exchange, nil
+	}
+
+	exchange.Response, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(rawResponse)), req)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response: %w", err)
+	}
+	exchange.RawResponse = rawResponse
+
+	return exchange, nil
+}
+
+// burpHost omits the default port of the protocol.
+func burpHost(item *burpItem) string {
+	if item.Port == "" ||
+		item.Protocol == "http" && item.Port == "80" ||
+		item.Protocol == "https" && item.Port == "443" {
+		return item.Host
+	}
+	return net.JoinHostPort(item.Host, item.Port)
+}
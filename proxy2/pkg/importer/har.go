@@ -0,0 +1,171 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"http-proxy/pkg/har"
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func readHAR(data []byte) ([]*Exchange, error) {
+	var archive har.HAR
+	if err := json.Unmarshal(data, &archive); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %w", err)
+	}
+
+	exchanges := make([]*Exchange, 0, len(archive.Log.Entries))
+	for i, entry := range archive.Log.Entries {
+		exchange, err := harExchange(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+
+	return exchanges, nil
+}
+
+func harExchange(entry *har.Entry) (*Exchange, error) {
+	if entry.Request == nil {
+		return nil, errors.New("missing request")
+	}
+
+	req, err := harRequest(entry.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	started, err := time.Parse(time.RFC3339Nano, entry.StartedDateTime)
+	if err != nil {
+		return nil, fmt.Errorf("invalid startedDateTime: %w", err)
+	}
+	exchange := &Exchange{Request: req, Timestamp: started}
+
+	// Status 0 marks requests that were aborted or blocked.
+	if entry.Response == nil || entry.Response.Status == 0 {
+		return exchange, nil
+	}
+
+	exchange.Response, err = harResponse(entry.Response, req)
+	if err != nil {
+		return nil, err
+	}
+
+	exchange.Timings = &repo.Timings{
+		Started: primitive.NewDateTimeFromTime(exchange.Timestamp),
+		Connect: entry.Timings.Connect,
+		Send:    entry.Timings.Send,
+		Wait:    entry.Timings.Wait,
+		Receive: entry.Timings.Receive,
+	}
+
+	return exchange, nil
+}
+
+func harRequest(data *har.Request) (*http.Request, error) {
+	body, err := harPostData(data.PostData)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequest(data.Method, data.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header = harHeader(data.Headers)
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+		req.Header.Del("Host")
+	}
+	if req.Header.Get("Cookie") == "" {
+		for _, cookie := range data.Cookies {
+			req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+		}
+	}
+
+	return req, nil
+}
+
+// harPostData returns the body, which is encoded from the parameters if the
+// text is missing.
+func harPostData(data *har.PostData) ([]byte, error) {
+	if data == nil {
+		return nil, nil
+	}
+
+	if data.Text != "" || len(data.Params) == 0 {
+		return decodeText(data.Text, data.Encoding)
+	}
+
+	form := url.Values{}
+	for _, param := range data.Params {
+		form.Add(param.Name, param.Value)
+	}
+	return []byte(form.Encode()), nil
+}
+
+func harResponse(data *har.Response, req *http.Request) (*http.Response, error) {
+	body, err := decodeText(data.Content.Text, data.Content.Encoding)
+	if err != nil {
+		return nil, err
+	}
+
+	// HAR content is decoded already.
+	header := harHeader(data.Headers)
+	header.Del("Content-Encoding")
+
+	proto := data.HTTPVersion
+	major, minor, ok := http.ParseHTTPVersion(proto)
+	if !ok {
+		proto, major, minor = "HTTP/1.1", 1, 1
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", data.Status, data.StatusText),
+		StatusCode:    data.Status,
+		Proto:         proto,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// harHeader skips the pseudo-headers of HTTP/2 captures. The framing headers
+// are dropped as well, since they describe the body on the wire rather than
+// the one rebuilt from the archive.
+func harHeader(headers []har.NameValue) http.Header {
+	header := http.Header{}
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Name, ":") {
+			header.Add(h.Name, h.Value)
+		}
+	}
+	header.Del("Content-Length")
+	header.Del("Transfer-Encoding")
+	return header
+}
+
+func decodeText(text, encoding string) ([]byte, error) {
+	switch encoding {
+	case "":
+		return []byte(text), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(text)
+	}
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
@@ -0,0 +1,130 @@
+// Package importer stores traffic captured by other tools, so that it can be
+// repeated and scanned like proxied traffic.
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"http-proxy/repo"
+)
+
+const (
+	FormatHAR  = "har"
+	FormatBurp = "burp"
+)
+
+// Exchange is an imported request together with its response, which is nil
+// for unanswered requests.
+type Exchange struct {
+	Request     *http.Request
+	Response    *http.Response
+	RawRequest  []byte
+	RawResponse []byte
+	Timestamp   time.Time
+	Timings     *repo.Timings
+}
+
+// Result identifies the records created for an exchange.
+type Result struct {
+	RequestID  string `json:"request_id"`
+	ResponseID string `json:"response_id,omitempty"`
+}
+
+// Import reads and stores all exchanges of a file. format is detected from
+// the content if it is empty.
+func Import(r io.Reader, format string, requests repo.RequestSaver, responses repo.ResponseSaver, opts ...repo.SaveOption) ([]Result, error) {
+	exchanges, err := Read(r, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return Save(exchanges, requests, responses, opts...)
+}
+
+func Read(r io.Reader, format string) ([]*Exchange, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == "" {
+		format = detectFormat(data)
+	}
+
+	switch format {
+	case FormatHAR:
+		return readHAR(data)
+	case FormatBurp:
+		return readBurp(data)
+	case "":
+		return nil, errors.New("unknown format, expected a HAR or Burp XML file")
+	}
+
+	return nil, fmt.Errorf("unknown format %q, expected %s or %s", format, FormatHAR, FormatBurp)
+}
+
+// detectFormat tells JSON from XML by the first character.
+func detectFormat(data []byte) string {
+	data = bytes.TrimLeft(data, "\ufeff \t\r\n")
+	if len(data) == 0 {
+		return ""
+	}
+
+	switch data[0] {
+	case '{':
+		return FormatHAR
+	case '<':
+		return FormatBurp
+	}
+	return ""
+}
+
+// Save stores the exchanges in order and stops at the first error, returning
+// the records created so far. opts apply to every record.
+func Save(exchanges []*Exchange, requests repo.RequestSaver, responses repo.ResponseSaver, opts ...repo.SaveOption) ([]Result, error) {
+	results := make([]Result, 0, len(exchanges))
+
+	for i, exchange := range exchanges {
+		result, err := save(exchange, requests, responses, opts)
+		if err != nil {
+			return results, fmt.Errorf("exchange %d: %w", i, err)
+		}
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+func save(exchange *Exchange, requests repo.RequestSaver, responses repo.ResponseSaver, common []repo.SaveOption) (Result, error) {
+	var result Result
+	var err error
+
+	opts := append([]repo.SaveOption{repo.WithSource(repo.SourceImport), repo.WithTimestamp(exchange.Timestamp)}, common...)
+	if exchange.RawRequest != nil {
+		opts = append(opts, repo.WithRaw(exchange.RawRequest, false))
+	}
+
+	result.RequestID, err = requests.Save(exchange.Request, opts...)
+	exchange.Request.Body.Close()
+	if err != nil || exchange.Response == nil {
+		return result, err
+	}
+
+	opts = append([]repo.SaveOption{repo.WithSource(repo.SourceImport), repo.WithTimestamp(exchange.Timestamp)}, common...)
+	if exchange.RawResponse != nil {
+		opts = append(opts, repo.WithRaw(exchange.RawResponse, false))
+	}
+	if exchange.Timings != nil {
+		opts = append(opts, repo.WithTimings(*exchange.Timings))
+	}
+
+	result.ResponseID, err = responses.Save(result.RequestID, exchange.Response, opts...)
+	exchange.Response.Body.Close()
+
+	return result, err
+}
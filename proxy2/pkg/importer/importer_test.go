@@ -0,0 +1,200 @@
+package importer
+
+import (
+	"encoding/base64"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"http-proxy/repo"
+)
+
+const harArchive = `{"log": {"version": "1.2", "entries": [
+	{
+		"startedDateTime": "2024-01-02T03:04:05.678Z",
+		"request": {
+			"method": "POST",
+			"url": "http://example.com/login",
+			"headers": [
+				{"name": "Content-Type", "value": "application/x-www-form-urlencoded"},
+				{"name": "Content-Length", "value": "999"},
+				{"name": "Transfer-Encoding", "value": "chunked"}
+			],
+			"postData": {"mimeType": "application/x-www-form-urlencoded", "text": "user=a"}
+		},
+		"response": {
+			"status": 200,
+			"statusText": "OK",
+			"httpVersion": "HTTP/1.1",
+			"headers": [
+				{"name": "Content-Encoding", "value": "gzip"},
+				{"name": "Content-Length", "value": "20"}
+			],
+			"content": {"size": 5, "text": "hello"}
+		}
+	},
+	{
+		"startedDateTime": "2024-01-02T03:04:06Z",
+		"request": {"method": "GET", "url": "http://example.com/"},
+		"response": {"status": 0}
+	}
+]}}`
+
+func TestReadHAR(t *testing.T) {
+	exchanges, err := Read(strings.NewReader(harArchive), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exchanges) != 2 {
+		t.Fatalf("read %d exchanges, want 2", len(exchanges))
+	}
+
+	first := exchanges[0]
+	if got := first.Timestamp.UTC().Format("2006-01-02T15:04:05.000"); got != "2024-01-02T03:04:05.678" {
+		t.Errorf("timestamp = %s", got)
+	}
+
+	req := first.Request
+	for _, name := range []string{"Content-Length", "Transfer-Encoding"} {
+		if req.Header.Get(name) != "" {
+			t.Errorf("request keeps %s", name)
+		}
+	}
+	if req.ContentLength != int64(len("user=a")) {
+		t.Errorf("request ContentLength = %d", req.ContentLength)
+	}
+
+	resp := first.Response
+	for _, name := range []string{"Content-Length", "Content-Encoding"} {
+		if resp.Header.Get(name) != "" {
+			t.Errorf("response keeps %s", name)
+		}
+	}
+	if body, _ := io.ReadAll(resp.Body); string(body) != "hello" || resp.ContentLength != 5 {
+		t.Errorf("response body = %q, length %d", body, resp.ContentLength)
+	}
+
+	if exchanges[1].Response != nil {
+		t.Error("response of an unanswered request")
+	}
+}
+
+func TestReadHARInvalidEntries(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr string
+	}{
+		{
+			name:    "bad startedDateTime",
+			entry:   `{"startedDateTime": "yesterday", "request": {"method": "GET", "url": "http://example.com/"}}`,
+			wantErr: "entry 0: invalid startedDateTime",
+		},
+		{
+			name:    "missing startedDateTime",
+			entry:   `{"request": {"method": "GET", "url": "http://example.com/"}}`,
+			wantErr: "entry 0: invalid startedDateTime",
+		},
+		{
+			name:    "missing request",
+			entry:   `{"startedDateTime": "2024-01-02T03:04:05Z"}`,
+			wantErr: "entry 0: missing request",
+		},
+		{
+			name:    "bad encoding",
+			entry:   `{"startedDateTime": "2024-01-02T03:04:05Z", "request": {"method": "GET", "url": "http://example.com/"}, "response": {"status": 200, "content": {"text": "x", "encoding": "rot13"}}}`,
+			wantErr: "entry 0: unsupported encoding",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Read(strings.NewReader(`{"log": {"entries": [`+tt.entry+`]}}`), FormatHAR)
+			if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// failingRequestSaver fails once it has stored a number of requests.
+type failingRequestSaver struct {
+	repo.RequestSaver
+	left int
+}
+
+func (s *failingRequestSaver) Save(req *http.Request, opts ...repo.SaveOption) (string, error) {
+	if s.left == 0 {
+		return "", errors.New("storage full")
+	}
+	s.left--
+	return s.RequestSaver.Save(req, opts...)
+}
+
+func TestSavePartial(t *testing.T) {
+	exchanges, err := Read(strings.NewReader(harArchive), FormatHAR)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requests := &failingRequestSaver{RequestSaver: repo.NewMemoryRequestSaver(nil), left: 1}
+	results, err := Save(exchanges, requests, repo.NewMemoryResponseSaver(nil))
+	if err == nil || !strings.Contains(err.Error(), "exchange 1") {
+		t.Errorf("error = %v, want a failure of exchange 1", err)
+	}
+	if len(results) != 1 || results[0].RequestID == "" || results[0].ResponseID == "" {
+		t.Fatalf("results = %+v, want the first exchange", results)
+	}
+
+	stored, err := requests.Get(results[0].RequestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Source != repo.SourceImport {
+		t.Errorf("source = %q", stored.Source)
+	}
+}
+
+func TestReadBurp(t *testing.T) {
+	request := base64.StdEncoding.EncodeToString([]byte("GET /a HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+	item := func(time string) string {
+		return `<item><time>` + time + `</time><host>example.com</host><port>443</port><protocol>https</protocol>` +
+			`<request base64="true">` + request + `</request><response base64="true"></response></item>`
+	}
+
+	tests := []struct {
+		name     string
+		time     string
+		wantTime time.Time
+		wantErr  string
+	}{
+		{name: "valid", time: "Tue Jan 02 03:04:05 UTC 2024", wantTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{name: "bad time", time: "yesterday", wantErr: "item 0: invalid time"},
+		{name: "missing time", wantErr: "item 0: invalid time"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exchanges, err := Read(strings.NewReader(`<items>`+item(tt.time)+`</items>`), FormatBurp)
+			if tt.wantErr != "" {
+				if err == nil || !strings.HasPrefix(err.Error(), tt.wantErr) {
+					t.Errorf("error = %v, want %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(exchanges) != 1 || !exchanges[0].Timestamp.Equal(tt.wantTime) {
+				t.Fatalf("exchanges = %+v", exchanges)
+			}
+			if req := exchanges[0].Request; req.URL.Scheme != "https" || req.Host != "example.com" || req.URL.Path != "/a" {
+				t.Errorf("request = %s %s%s", req.URL.Scheme, req.Host, req.URL.Path)
+			}
+		})
+	}
+}
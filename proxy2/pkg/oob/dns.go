@@ -0,0 +1,110 @@
+package oob
+
+import (
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsTTL is short, so that every lookup of a payload reaches the listener.
+const dnsTTL = 1
+
+func (s *Server) serveDNS() error {
+	conn, err := net.ListenPacket("udp", s.options.DNSAddr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("OOB DNS listening at %s...", s.options.DNSAddr)
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				log.Print(err)
+				return
+			}
+
+			if answer, err := s.handleDNS(buf[:n], addr); err == nil {
+				conn.WriteTo(answer, addr)
+			}
+		}
+	}()
+	return nil
+}
+
+// handleDNS records the questions for names below the domain and answers
+// them with the configured address. Other names are refused.
+func (s *Server) handleDNS(query []byte, addr net.Addr) ([]byte, error) {
+	var parser dnsmessage.Parser
+	header, err := parser.Start(query)
+	if err != nil {
+		return nil, err
+	}
+	questions, err := parser.AllQuestions()
+	if err != nil {
+		return nil, err
+	}
+
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{
+		ID:               header.ID,
+		Response:         true,
+		Authoritative:    true,
+		RecursionDesired: header.RecursionDesired,
+		RCode:            dnsmessage.RCodeSuccess,
+		OpCode:           header.OpCode,
+	})
+	builder.EnableCompression()
+
+	var answers []dnsmessage.Question
+	suffix := "." + strings.ToLower(strings.Trim(s.options.Domain, ".")) + "."
+	for _, question := range questions {
+		name := strings.ToLower(question.Name.String())
+		if !strings.HasSuffix(name, suffix) && name != suffix[1:] {
+			continue
+		}
+
+		s.record(strings.Split(strings.TrimSuffix(name, suffix), "."), Interaction{
+			Protocol:   "dns",
+			RemoteAddr: addr.String(),
+			Timestamp:  time.Now(),
+			Detail:     question.Type.String() + " " + question.Name.String(),
+		})
+		answers = append(answers, question)
+	}
+
+	if len(answers) == 0 {
+		builder = dnsmessage.NewBuilder(nil, dnsmessage.Header{ID: header.ID, Response: true, RCode: dnsmessage.RCodeRefused})
+	}
+
+	if err := builder.StartQuestions(); err != nil {
+		return nil, err
+	}
+	for _, question := range questions {
+		if err := builder.Question(question); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := builder.StartAnswers(); err != nil {
+		return nil, err
+	}
+	for _, question := range answers {
+		resource := dnsmessage.ResourceHeader{Name: question.Name, Class: dnsmessage.ClassINET, TTL: dnsTTL}
+
+		switch ip4, ip6 := s.ip.To4(), s.ip.To16(); {
+		case question.Type == dnsmessage.TypeA && ip4 != nil:
+			err = builder.AResource(resource, dnsmessage.AResource{A: [4]byte(ip4)})
+		case question.Type == dnsmessage.TypeAAAA && ip4 == nil:
+			err = builder.AAAAResource(resource, dnsmessage.AAAAResource{AAAA: [16]byte(ip6)})
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return builder.Finish()
+}
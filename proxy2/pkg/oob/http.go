@@ -0,0 +1,52 @@
+package oob
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+	"time"
+)
+
+// maxHTTPDetail limits the part of a callback request kept as detail.
+const maxHTTPDetail = 8 << 10
+
+func (s *Server) serveHTTP() error {
+	listener, err := net.Listen("tcp", s.options.HTTPAddr)
+	if err != nil {
+		return err
+	}
+
+	server := &http.Server{
+		Handler:           http.HandlerFunc(s.handleHTTP),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	log.Printf("OOB HTTP listening at %s...", s.options.HTTPAddr)
+	go func() {
+		log.Print(server.Serve(listener))
+	}()
+	return nil
+}
+
+// handleHTTP records a request whose path or Host subdomain holds a token.
+func (s *Server) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	dump, _ := httputil.DumpRequest(r, true)
+	if len(dump) > maxHTTPDetail {
+		dump = dump[:maxHTTPDetail]
+	}
+
+	candidates := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	candidates = append(candidates, strings.Split(hostname(r.Host), ".")...)
+
+	s.record(candidates, Interaction{
+		Protocol:   "http",
+		RemoteAddr: r.RemoteAddr,
+		Timestamp:  time.Now(),
+		Detail:     string(dump),
+	})
+
+	w.Header().Set("Content-Type", "text/plain")
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,258 @@
+// Package oob records out-of-band interactions, i.e. HTTP requests and DNS
+// lookups which injected payloads make the scanned server send, so that
+// blind vulnerabilities are found. Payloads name a local stand-in domain,
+// so that everything works offline if the server resolves it through the
+// DNS listener.
+package oob
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxRecords limits the payloads kept in memory, the oldest are dropped.
+const maxRecords = 10000
+
+const tokenChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// awaitInterval is how often Await looks for new interactions.
+const awaitInterval = 100 * time.Millisecond
+
+type Options struct {
+	// HTTPAddr and DNSAddr are the listener addresses, an empty address
+	// disables the listener.
+	HTTPAddr string
+	DNSAddr  string
+	// Domain is the stand-in domain of DNS payloads.
+	Domain string
+	// Host is the address of the HTTP listener as seen from scanned
+	// servers, and answered to DNS lookups if it is an IP. It defaults to
+	// HTTPAddr, with 127.0.0.1 for a missing host.
+	Host string
+	// Wait is how long checks wait for interactions after sending.
+	Wait time.Duration
+}
+
+// Correlation tells where a payload was used.
+type Correlation struct {
+	// TargetID is the scanned request.
+	TargetID       string `json:"target_id"`
+	Check          string `json:"check"`
+	Variant        string `json:"variant,omitempty"`
+	InsertionPoint string `json:"insertion_point,omitempty"`
+}
+
+// Payload is a unique callback address.
+type Payload struct {
+	Token string `json:"token"`
+	// URL is served by the HTTP listener.
+	URL string `json:"url"`
+	// Domain is resolved by the DNS listener.
+	Domain string `json:"domain"`
+}
+
+type Interaction struct {
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remote_addr"`
+	Timestamp  time.Time `json:"timestamp"`
+	// Detail is the HTTP request or the DNS question.
+	Detail string `json:"detail"`
+}
+
+// Record is an issued payload with the interactions it caused.
+type Record struct {
+	Payload
+	Correlation
+	// RequestID is the request which carried the payload.
+	RequestID    string        `json:"request_id,omitempty"`
+	Created      time.Time     `json:"created"`
+	Interactions []Interaction `json:"interactions"`
+}
+
+type Server struct {
+	options Options
+	ip      net.IP
+
+	mu      sync.Mutex
+	records map[string]*Record
+	order   []string
+}
+
+func NewServer(options Options) *Server {
+	if options.Host == "" {
+		host, port, _ := net.SplitHostPort(options.HTTPAddr)
+		if host == "" {
+			host = "127.0.0.1"
+		}
+		options.Host = net.JoinHostPort(host, port)
+	}
+
+	s := &Server{
+		options: options,
+		records: make(map[string]*Record),
+	}
+
+	s.ip = net.ParseIP(hostname(options.Host))
+	if s.ip == nil {
+		s.ip = net.IPv4(127, 0, 0, 1)
+	}
+	return s
+}
+
+// Start starts the listeners, which run until the process exits.
+func (s *Server) Start() error {
+	var errs []error
+	if s.options.HTTPAddr != "" {
+		errs = append(errs, s.serveHTTP())
+	}
+	if s.options.DNSAddr != "" {
+		errs = append(errs, s.serveDNS())
+	}
+	return errors.Join(errs...)
+}
+
+// Wait is how long checks wait for interactions.
+func (s *Server) Wait() time.Duration {
+	return s.options.Wait
+}
+
+// Issue returns a new payload used as described by c.
+func (s *Server) Issue(c Correlation) Payload {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := newToken()
+	for s.records[token] != nil {
+		token = newToken()
+	}
+
+	record := &Record{
+		Payload: Payload{
+			Token:  token,
+			URL:    "http://" + s.options.Host + "/" + token,
+			Domain: token + "." + s.options.Domain,
+		},
+		Correlation:  c,
+		Created:      time.Now(),
+		Interactions: []Interaction{},
+	}
+	s.records[token] = record
+
+	s.order = append(s.order, token)
+	if len(s.order) > maxRecords {
+		delete(s.records, s.order[0])
+		s.order = s.order[1:]
+	}
+
+	return record.Payload
+}
+
+// Attach links a payload to the request which carried it.
+func (s *Server) Attach(token, requestID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if record := s.records[token]; record != nil {
+		record.RequestID = requestID
+	}
+}
+
+// Await waits until every payload caused an interaction, for the configured
+// time or until ctx is done, and returns the records of the payloads with
+// interactions. Payloads may be triggered late or not at all, so it does not
+// return at the first one.
+func (s *Server) Await(ctx context.Context, tokens []string) []Record {
+	ctx, cancel := context.WithTimeout(ctx, s.options.Wait)
+	defer cancel()
+
+	ticker := time.NewTicker(awaitInterval)
+	defer ticker.Stop()
+
+	for {
+		records := s.interacted(tokens)
+		if len(records) == len(tokens) {
+			return records
+		}
+
+		select {
+		case <-ctx.Done():
+			return s.interacted(tokens)
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Server) interacted(tokens []string) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []Record
+	for _, token := range tokens {
+		if record := s.records[token]; record != nil && len(record.Interactions) != 0 {
+			records = append(records, copyRecord(record))
+		}
+	}
+	return records
+}
+
+// List returns the records of a scanned request, or all of them if
+// targetID is empty, newest first. With interacted set only payloads with
+// interactions are listed.
+func (s *Server) List(targetID string, interacted bool) []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	records := []Record{}
+	for _, token := range slices.Backward(s.order) {
+		record := s.records[token]
+		if targetID != "" && record.TargetID != targetID {
+			continue
+		}
+		if interacted && len(record.Interactions) == 0 {
+			continue
+		}
+		records = append(records, copyRecord(record))
+	}
+	return records
+}
+
+// record stores an interaction for the first known token among the
+// candidates, e.g. the labels of a DNS name.
+func (s *Server) record(candidates []string, interaction Interaction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, candidate := range candidates {
+		if record := s.records[strings.ToLower(candidate)]; record != nil {
+			record.Interactions = append(record.Interactions, interaction)
+			return
+		}
+	}
+}
+
+func copyRecord(record *Record) Record {
+	copied := *record
+	copied.Interactions = slices.Clone(record.Interactions)
+	return copied
+}
+
+func newToken() string {
+	token := make([]byte, 12)
+	for i := range token {
+		token[i] = tokenChars[rand.IntN(len(tokenChars))]
+	}
+	return string(token)
+}
+
+func hostname(hostport string) string {
+	if host, _, err := net.SplitHostPort(hostport); err == nil {
+		return host
+	}
+	return hostport
+}
@@ -0,0 +1,54 @@
+package oob
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestAwait(t *testing.T) {
+	const wait = 500 * time.Millisecond
+
+	tests := []struct {
+		name        string
+		interacted  []int
+		late        []int
+		wantRecords int
+		wantFull    bool
+	}{
+		{name: "none", wantFull: true},
+		{name: "all", interacted: []int{0, 1}, wantRecords: 2},
+		{name: "one of two", interacted: []int{0}, wantRecords: 1, wantFull: true},
+		{name: "late interaction", interacted: []int{0}, late: []int{1}, wantRecords: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(Options{HTTPAddr: "127.0.0.1:0", Domain: "oob.test", Wait: wait})
+			tokens := []string{
+				s.Issue(Correlation{Check: "test"}).Token,
+				s.Issue(Correlation{Check: "test"}).Token,
+			}
+
+			for _, i := range tt.interacted {
+				s.record([]string{tokens[i]}, Interaction{Protocol: "http"})
+			}
+			for _, i := range tt.late {
+				time.AfterFunc(wait/5, func() {
+					s.record([]string{tokens[i]}, Interaction{Protocol: "dns"})
+				})
+			}
+
+			start := time.Now()
+			records := s.Await(context.Background(), tokens)
+			elapsed := time.Since(start)
+
+			if len(records) != tt.wantRecords {
+				t.Errorf("got %d records, want %d", len(records), tt.wantRecords)
+			}
+			if full := elapsed >= wait; full != tt.wantFull {
+				t.Errorf("waited %v of %v", elapsed, wait)
+			}
+		})
+	}
+}
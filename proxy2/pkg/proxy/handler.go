@@ -2,212 +2,389 @@ package proxy
 
 import (
 	"bufio"
-	"bytes"
 	"crypto/tls"
 	"errors"
-	"fmt"
 	"io"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"http-proxy/pkg/ca"
 	"http-proxy/pkg/http_utils"
 	"http-proxy/repo"
 )
 
 type Handler struct {
-	certs         map[string][]byte
-	mutex         sync.Mutex
-	key           []byte
+	authority     ca.Authority
 	requestSaver  repo.RequestSaver
 	responseSaver repo.ResponseSaver
+	options       Options
 }
 
-func NewHandler(req repo.RequestSaver, resp repo.ResponseSaver) (*Handler, error) {
-	keyBytes, err := os.ReadFile("https/cert.key")
-	if err != nil {
-		return nil, err
-	}
+type Options struct {
+	// BodyLimit is the number of body bytes stored inline in a record.
+	BodyLimit int64
+	// UpstreamTimeout limits connecting to a server and every read and
+	// write on the connection.
+	UpstreamTimeout time.Duration
+	// KeepAliveTimeout is how long an idle client connection is kept open.
+	KeepAliveTimeout time.Duration
+}
 
-	certs, err := loadCertificates()
-	if err != nil {
-		return nil, err
+func NewHandler(authority ca.Authority, req repo.RequestSaver, resp repo.ResponseSaver, options Options) (*Handler, error) {
+	if authority == nil {
+		return nil, errors.New("certificate authority is required")
 	}
 
 	return &Handler{
-		certs:         certs,
-		key:           keyBytes,
+		authority:     authority,
 		requestSaver:  req,
 		responseSaver: resp,
+		options:       options,
 	}, nil
 }
 
-func (h *Handler) Handle(conn net.Conn) error {
-	req, err := http.ReadRequest(bufio.NewReader(conn))
+// maxHeaderBytes is the part of a raw message reserved for its head.
+const maxHeaderBytes = 64 << 10
+
+// hostConn is an upstream connection together with its buffered reader, so
+// that it can be reused for several requests of the same client.
+type hostConn struct {
+	net.Conn
+	reader     *bufio.Reader
+	recorder   *recorder
+	addr       string
+	serverName string
+}
+
+// bufferedConn reads through the buffered reader of a connection, so that
+// bytes which were read ahead are not lost when the connection is wrapped.
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+// session is the state of a single client connection.
+type session struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	recorder *recorder
+	rawLimit int
+	timeout  time.Duration
+	host     *hostConn
+}
+
+func (h *Handler) newSession(conn net.Conn) *session {
+	recorder := newRecorder(conn, h.rawLimit())
+	return &session{
+		conn:     conn,
+		reader:   bufio.NewReader(recorder),
+		recorder: recorder,
+		rawLimit: h.rawLimit(),
+		timeout:  h.options.UpstreamTimeout,
+	}
+}
+
+func (s *session) hostConn(scheme, host, port, serverName string) (*hostConn, bool, error) {
+	addr := net.JoinHostPort(host, port)
+	if s.host != nil && s.host.addr == addr && s.host.serverName == serverName {
+		return s.host, true, nil
+	}
+	s.closeHost()
+
+	var conn net.Conn
+	var err error
+
+	if scheme == "https" {
+		conn, err = utils.TLSConnect(host, port, serverName, s.timeout)
+	} else {
+		conn, err = utils.TCPConnect(host, port, s.timeout)
+	}
 	if err != nil {
-		return err
+		return nil, false, err
+	}
+	conn = utils.WithIdleTimeout(conn, s.timeout)
+	recorder := newRecorder(conn, s.rawLimit)
+
+	s.host = &hostConn{
+		Conn:       conn,
+		reader:     bufio.NewReader(recorder),
+		recorder:   recorder,
+		addr:       addr,
+		serverName: serverName,
 	}
+	return s.host, false, nil
+}
 
-	return h.handleRequest(conn, req)
+func (s *session) closeHost() {
+	if s.host != nil {
+		s.host.Close()
+		s.host = nil
+	}
 }
 
-func (h *Handler) handleRequest(clientConn net.Conn, toProxy *http.Request) error {
-	var hostConn net.Conn
-	var err error
+func (h *Handler) Handle(conn net.Conn) error {
+	s := h.newSession(utils.WithIdleTimeout(conn, h.options.KeepAliveTimeout))
+	defer s.closeHost()
 
-	host := toProxy.URL.Hostname()
-	port := utils.GetPort(toProxy.URL)
+	return h.serve(s, "http", "")
+}
 
-	if toProxy.Method == http.MethodConnect {
-		clientConn, err = h.tlsUpgrade(clientConn, host)
+// serve reads requests from the client until either side asks to close the
+// connection. target is the CONNECT authority for tunneled connections.
+func (h *Handler) serve(s *session, scheme, target string) error {
+	for {
+		req, err := http.ReadRequest(s.reader)
 		if err != nil {
+			if isClosed(err) {
+				return nil
+			}
 			return err
 		}
 
-		toProxy, err = http.ReadRequest(bufio.NewReader(clientConn))
-		if err != nil {
-			return err
+		if tlsConn, ok := s.conn.(*tls.Conn); ok {
+			state := tlsConn.ConnectionState()
+			req.TLS = &state
 		}
 
-		toProxy.URL.Scheme = "https"
-		hostConn, err = utils.TLSConnect(host, port)
-		if err != nil {
-			return err
+		if req.Method == http.MethodConnect {
+			if target != "" {
+				return errors.New("CONNECT inside of a tunnel is not supported")
+			}
+			return h.handleConnect(s, req)
 		}
-	} else {
-		toProxy.URL.Scheme = "http"
-		hostConn, err = utils.TCPConnect(host, port)
+
+		keepAlive, err := h.handleRequest(s, req, scheme, target)
 		if err != nil {
 			return err
 		}
+		if !keepAlive {
+			return nil
+		}
 	}
+}
 
-	defer hostConn.Close()
+func (h *Handler) handleConnect(s *session, req *http.Request) error {
+	s.closeHost()
 
-	prepareRequest(toProxy)
-	requestId, err := h.requestSaver.Save(toProxy)
+	// The tunnel is recorded by its own session. The client may have sent
+	// the start of the TLS handshake along with the CONNECT, which is read
+	// through the buffered reader.
+	s.recorder.stop()
+	conn := &bufferedConn{Conn: s.conn, reader: s.reader}
+
+	tlsConn, err := h.tlsUpgrade(conn, req.URL.Hostname())
 	if err != nil {
 		return err
 	}
 
-	resp, err := utils.SendRequest(hostConn, toProxy)
+	tunnel := h.newSession(tlsConn)
+	defer tunnel.closeHost()
+
+	return h.serve(tunnel, "https", req.URL.Host)
+}
+
+func (h *Handler) handleRequest(s *session, toProxy *http.Request, scheme, target string) (bool, error) {
+	toProxy.URL.Scheme = scheme
+	if target == "" {
+		target = net.JoinHostPort(toProxy.URL.Hostname(), utils.GetPort(toProxy.URL))
+	}
+
+	host, port, err := net.SplitHostPort(target)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	defer resp.Body.Close()
+	prepareRequest(toProxy)
 
-	h.responseSaver.Save(requestId, resp)
+	// Bodies are streamed between the peers and captured on the way, so the
+	// records are saved once the transfer is complete.
+	if toProxy.Body != http.NoBody {
+		body := repo.NewCapture(toProxy.Body, h.options.BodyLimit)
+		defer body.Release()
+		toProxy.Body = body
+	}
 
-	return utils.WriteResponse(resp, clientConn)
-}
+	timer := newTimer()
+	resp, sendErr := h.sendRequest(s, toProxy, scheme, host, port, timer)
 
-func (h *Handler) getTlsConfig(host string) (*tls.Config, error) {
-	cert, err := tls.X509KeyPair(h.certs[host], h.key)
+	requestId, err := h.saveRequest(s, toProxy)
+	if sendErr != nil {
+		return h.handleSendError(s, toProxy, sendErr, err)
+	}
 	if err != nil {
-		return nil, err
+		resp.Body.Close()
+		return false, err
 	}
-	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
-}
 
-func (h *Handler) tlsUpgrade(clientConn net.Conn, host string) (net.Conn, error) {
-	_, err := clientConn.Write([]byte("HTTP/1.0 200 Connection established\n\n"))
-	if err != nil {
-		return nil, err
+	defer resp.Body.Close()
+
+	if resp.Body != http.NoBody {
+		body := repo.NewCapture(resp.Body, h.options.BodyLimit)
+		defer body.Release()
+		resp.Body = body
 	}
 
-	err = h.generateCertificate(host)
-	if err != nil {
-		return nil, err
+	keepAlive := !toProxy.Close && !resp.Close
+	if !keepAlive {
+		resp.Close = true
+	}
+	if resp.Close {
+		defer s.closeHost()
 	}
 
-	cfg, err := h.getTlsConfig(host)
-	if err != nil {
-		return nil, err
+	if err := utils.WriteResponse(resp, s.conn, s.timeout); err != nil {
+		return false, err
 	}
 
-	tlsConn := tls.Server(clientConn, cfg)
-	clientConn.SetReadDeadline(time.Now().Add(utils.DefaultTimeout))
+	if _, err := h.saveResponse(s, requestId, resp, timer); err != nil {
+		return false, err
+	}
 
-	return tlsConn, nil
+	return keepAlive, nil
 }
 
-func (h *Handler) generateCertificate(host string) error {
-	h.mutex.Lock()
-	defer h.mutex.Unlock()
+// handleSendError answers the client with a 502 if the server could not be
+// reached or did not answer. The request has been read completely, so the
+// client connection is kept unless saving it failed.
+func (h *Handler) handleSendError(s *session, req *http.Request, sendErr, saveErr error) (bool, error) {
+	s.closeHost()
+	if saveErr != nil {
+		return false, saveErr
+	}
 
-	_, exists := h.certs[host]
-	if !exists {
-		fmt.Printf("Generating certificate for %s\n", host)
-		cert, err := generateCertificate(host)
-		if err != nil {
-			return fmt.Errorf("error generating certificate: %v", err)
+	if err := utils.WriteError(sendErr, http.StatusBadGateway, s.conn, s.timeout); err != nil {
+		return false, err
+	}
+	return !req.Close, nil
+}
+
+// saveRequest stores the request together with its raw form once the body
+// has been read completely.
+func (h *Handler) saveRequest(s *session, req *http.Request) (string, error) {
+	if body, ok := req.Body.(*repo.Capture); ok {
+		if err := body.Drain(); err != nil {
+			return "", err
 		}
-		h.certs[host] = cert
 	}
 
-	return nil
+	raw, truncated := s.recorder.take(s.reader.Buffered())
+	return h.requestSaver.Save(req, repo.WithRaw(raw, truncated))
 }
 
-func prepareRequest(r *http.Request) {
-	r.URL.Host = ""
-	r.Header.Del("Proxy-Connection")
-	r.Header.Del("Accept-Encoding")
+func (h *Handler) saveResponse(s *session, requestId string, resp *http.Response, timer *timer) (string, error) {
+	if body, ok := resp.Body.(*repo.Capture); ok {
+		if err := body.Drain(); err != nil {
+			return "", err
+		}
+	}
+	timings := timer.timings(time.Now())
+
+	raw, truncated := s.host.recorder.take(s.host.reader.Buffered())
+	return h.responseSaver.Save(requestId, resp, repo.WithRaw(raw, truncated), repo.WithTimings(timings))
+}
+
+// rawLimit leaves room for the message head on top of the body limit.
+func (h *Handler) rawLimit() int {
+	return int(h.options.BodyLimit) + maxHeaderBytes
 }
 
-func loadCertificates() (map[string][]byte, error) {
-	entries, err := os.ReadDir("certs")
+// sendRequest sends the request over the session's upstream connection. A
+// reused connection may have been closed by the server in the meantime, so
+// requests without a body are retried once on a fresh connection.
+func (h *Handler) sendRequest(s *session, req *http.Request, scheme, host, port string, timer *timer) (*http.Response, error) {
+	serverName := ""
+	if req.TLS != nil {
+		serverName = req.TLS.ServerName
+	}
+
+	hostConn, reused, err := s.hostConn(scheme, host, port, serverName)
 	if err != nil {
 		return nil, err
 	}
+	timer.connected, timer.reused = time.Now(), reused
 
-	res := make(map[string][]byte, len(entries))
-
-	for _, entry := range entries {
-		host := strings.TrimSuffix(entry.Name(), ".crt")
+	// A timeout means the server is slow rather than gone, so the request is
+	// not sent again.
+	resp, err := exchange(hostConn, req, timer, s.timeout)
+	if err == nil || !reused || req.ContentLength != 0 || !isClosed(err) || isTimeout(err) {
+		return resp, err
+	}
 
-		res[host], err = os.ReadFile("certs/" + entry.Name())
-		if err != nil {
-			return nil, err
-		}
+	s.closeHost()
+	hostConn, reused, err = s.hostConn(scheme, host, port, serverName)
+	if err != nil {
+		return nil, err
 	}
+	timer.connected, timer.reused = time.Now(), reused
 
-	return res, nil
+	return exchange(hostConn, req, timer, s.timeout)
 }
 
-func generateCertificate(host string) ([]byte, error) {
-	cmd := exec.Command("./https/gen.sh", host)
-	var out strings.Builder
-	cmd.Stdout = &out
-
-	err := cmd.Run()
-	if err != nil {
+func exchange(conn *hostConn, req *http.Request, timer *timer, timeout time.Duration) (*http.Response, error) {
+	if err := utils.WriteRequest(conn, req, timeout); err != nil {
 		return nil, err
 	}
+	timer.sent = time.Now()
 
-	res := []byte(out.String())
-
-	cert, err := os.Create(fmt.Sprintf("certs/%s.crt", host))
+	resp, err := utils.ReadResponse(conn, conn.reader, req, timeout)
 	if err != nil {
 		return nil, err
 	}
+	timer.headers = time.Now()
+
+	return resp, nil
+}
 
-	defer cert.Close()
+// isClosed tells whether err ends a connection normally, i.e. the peer
+// closed it or it was idle for too long.
+func isClosed(err error) bool {
+	if isTimeout(err) {
+		return true
+	}
+	return errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, net.ErrClosed) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.EPIPE)
+}
 
-	var written int64 = 0
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, os.ErrDeadlineExceeded) || errors.As(err, &netErr) && netErr.Timeout()
+}
 
-	written, err = io.Copy(cert, bytes.NewReader(res))
+// tlsUpgrade acknowledges the CONNECT and terminates TLS on the client side.
+// The certificate is chosen by the SNI of the ClientHello, falling back to the
+// CONNECT host for clients that do not send one.
+func (h *Handler) tlsUpgrade(clientConn net.Conn, host string) (net.Conn, error) {
+	_, err := clientConn.Write([]byte("HTTP/1.0 200 Connection established\n\n"))
 	if err != nil {
 		return nil, err
 	}
 
-	if written == 0 {
-		return nil, errors.New("0 bytes written during certificate creation")
+	cfg := &tls.Config{
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if hello.ServerName != "" {
+				return h.authority.Certificate(hello.ServerName)
+			}
+			return h.authority.Certificate(host)
+		},
 	}
 
-	return res, nil
+	tlsConn := tls.Server(clientConn, cfg)
+	clientConn.SetReadDeadline(time.Now().Add(h.options.UpstreamTimeout))
+
+	return tlsConn, nil
+}
+
+func prepareRequest(r *http.Request) {
+	r.URL.Host = ""
+	r.Header.Del("Proxy-Connection")
 }
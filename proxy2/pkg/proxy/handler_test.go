@@ -0,0 +1,362 @@
+package proxy
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"http-proxy/pkg/ca"
+	"http-proxy/repo"
+)
+
+// pipeliningConn sends a CONNECT request together with the first write of
+// the TLS client, and skips the CONNECT response before the first read.
+type pipeliningConn struct {
+	net.Conn
+	connect string
+	reader  *bufio.Reader
+	skipped bool
+}
+
+func (c *pipeliningConn) Write(p []byte) (int, error) {
+	if c.connect != "" {
+		data := append([]byte(c.connect), p...)
+		c.connect = ""
+		if _, err := c.Conn.Write(data); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return c.Conn.Write(p)
+}
+
+func (c *pipeliningConn) Read(p []byte) (int, error) {
+	if !c.skipped {
+		c.skipped = true
+		resp, err := http.ReadResponse(c.reader, nil)
+		if err != nil {
+			return 0, err
+		}
+		resp.Body.Close()
+	}
+	return c.reader.Read(p)
+}
+
+func TestConnectPipelinedHandshake(t *testing.T) {
+	authority, err := ca.Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewHandler(authority, repo.NewMemoryRequestSaver(nil), repo.NewMemoryResponseSaver(nil), Options{
+		BodyLimit:        1 << 20,
+		UpstreamTimeout:  5 * time.Second,
+		KeepAliveTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	defer client.Close()
+	go func() {
+		handler.Handle(server)
+		server.Close()
+	}()
+
+	conn := &pipeliningConn{
+		Conn:    client,
+		connect: "CONNECT example.com:443 HTTP/1.1\r\nHost: example.com:443\r\n\r\n",
+		reader:  bufio.NewReader(client),
+	}
+	tlsConn := tls.Client(conn, &tls.Config{ServerName: "example.com", RootCAs: authority.Pool()})
+	tlsConn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatalf("handshake: %v", err)
+	}
+	if name := tlsConn.ConnectionState().PeerCertificates[0].DNSNames[0]; name != "example.com" {
+		t.Errorf("certificate for %s, want example.com", name)
+	}
+}
+
+func TestConnectServerName(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := listener.Addr().String()
+	listener.Close()
+
+	tests := []struct {
+		name    string
+		connect string
+		// serverName is sent as SNI, clients send none for IP addresses.
+		serverName string
+		wantCert   string
+		wantSNI    string
+	}{
+		{name: "sni", connect: unreachable, serverName: "example.com", wantCert: "example.com", wantSNI: "example.com"},
+		{name: "connect host", connect: "connect.test:443", serverName: "127.0.0.1", wantCert: "connect.test"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := newTestHandler(t, 5*time.Second)
+			client := newProxyClient(t, handler)
+			defer client.Close()
+			client.SetDeadline(time.Now().Add(5 * time.Second))
+
+			fmt.Fprintf(client, "CONNECT %s HTTP/1.1\r\nHost: %s\r\n\r\n", tt.connect, tt.connect)
+			resp, err := http.ReadResponse(client.reader, nil)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				t.Fatalf("CONNECT: %v", err)
+			}
+
+			// The certificate is checked below, as it is not valid for an IP
+			// address.
+			tlsConn := tls.Client(&bufferedConn{Conn: client.Conn, reader: client.reader}, &tls.Config{
+				ServerName:         tt.serverName,
+				InsecureSkipVerify: true,
+			})
+			if err := tlsConn.Handshake(); err != nil {
+				t.Fatalf("handshake: %v", err)
+			}
+			cert := tlsConn.ConnectionState().PeerCertificates[0]
+			if err := cert.VerifyHostname(tt.wantCert); err != nil {
+				t.Errorf("certificate: %v", err)
+			}
+
+			// The server cannot be reached, the request is recorded all the
+			// same.
+			fmt.Fprint(tlsConn, "GET / HTTP/1.1\r\nHost: "+tt.connect+"\r\n\r\n")
+			resp, err = http.ReadResponse(bufio.NewReader(tlsConn), nil)
+			if err != nil || resp.StatusCode != http.StatusBadGateway {
+				t.Fatalf("response: %v", err)
+			}
+
+			page, err := handler.requestSaver.List(repo.Filter{}, repo.Page{Limit: 10})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(page.Items) != 1 || page.Items[0].SNI != tt.wantSNI {
+				t.Errorf("recorded %+v, want SNI %q", page.Items, tt.wantSNI)
+			}
+		})
+	}
+}
+
+func TestRecorderStop(t *testing.T) {
+	r := newRecorder(nil, 10)
+	r.record([]byte("CONNECT"))
+	r.stop()
+	r.record(make([]byte, 1<<20))
+
+	if len(r.buf) != 0 || len(r.tail) != 0 || r.size != 0 {
+		t.Errorf("stopped recorder kept %d+%d bytes", len(r.buf), len(r.tail))
+	}
+}
+
+func newTestHandler(t *testing.T, keepAlive time.Duration) *Handler {
+	authority, err := ca.Generate(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := NewHandler(authority, repo.NewMemoryRequestSaver(nil), repo.NewMemoryResponseSaver(nil), Options{
+		BodyLimit:        1 << 20,
+		UpstreamTimeout:  5 * time.Second,
+		KeepAliveTimeout: keepAlive,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return handler
+}
+
+// proxyClient is a TCP client connection served by a handler. done receives the
+// result of Handle.
+type proxyClient struct {
+	net.Conn
+	reader *bufio.Reader
+	done   chan error
+}
+
+func newProxyClient(t *testing.T, h *Handler) *proxyClient {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	client, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := &proxyClient{Conn: client, reader: bufio.NewReader(client), done: make(chan error, 1)}
+	go func() {
+		c.done <- h.Handle(server)
+		server.Close()
+	}()
+	return c
+}
+
+func (c *proxyClient) get(t *testing.T, url string, header string) *http.Response {
+	t.Helper()
+	c.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := fmt.Fprintf(c, "GET %s HTTP/1.1\r\nHost: upstream\r\n%s\r\n", url, header); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.ReadResponse(c.reader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(resp.Body); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func (c *proxyClient) wait(t *testing.T) error {
+	t.Helper()
+	select {
+	case err := <-c.done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+		return nil
+	}
+}
+
+// countingServer counts the connections made to it.
+func countingServer(handler http.Handler) (*httptest.Server, *atomic.Int64) {
+	var conns atomic.Int64
+	server := httptest.NewUnstartedServer(handler)
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			conns.Add(1)
+		}
+	}
+	server.Start()
+	return server, &conns
+}
+
+func TestHandleKeepAlive(t *testing.T) {
+	server, conns := countingServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		// header is sent with the second request.
+		header        string
+		wantConnClose bool
+	}{
+		{name: "keep alive"},
+		{name: "connection close", header: "Connection: close\r\n", wantConnClose: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conns.Store(0)
+			client := newProxyClient(t, newTestHandler(t, 5*time.Second))
+			defer client.Close()
+
+			for i, header := range []string{"", tt.header} {
+				resp := client.get(t, server.URL+"/"+strconv.Itoa(i), header)
+				if resp.StatusCode != http.StatusOK {
+					t.Fatalf("request %d: status %d", i, resp.StatusCode)
+				}
+				if resp.Close != (i == 1 && tt.wantConnClose) {
+					t.Errorf("request %d: close = %v", i, resp.Close)
+				}
+			}
+			if n := conns.Load(); n != 1 {
+				t.Errorf("%d upstream connections, want 1", n)
+			}
+
+			if !tt.wantConnClose {
+				client.Close()
+			}
+			if err := client.wait(t); err != nil {
+				t.Errorf("Handle: %v", err)
+			}
+		})
+	}
+}
+
+func TestHandleIdleTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newProxyClient(t, newTestHandler(t, 50*time.Millisecond))
+	defer client.Close()
+
+	client.get(t, server.URL+"/", "")
+	if err := client.wait(t); err != nil {
+		t.Errorf("idle connection closed with %v", err)
+	}
+}
+
+func TestHandleRetry(t *testing.T) {
+	// The server closes every connection after its response, without
+	// announcing it.
+	server, conns := countingServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		fmt.Fprint(conn, "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok")
+		conn.Close()
+	}))
+	defer server.Close()
+
+	client := newProxyClient(t, newTestHandler(t, 5*time.Second))
+	defer client.Close()
+
+	for i := 0; i < 2; i++ {
+		if resp := client.get(t, server.URL+"/", ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("request %d: status %d", i, resp.StatusCode)
+		}
+	}
+	if n := conns.Load(); n != 2 {
+		t.Errorf("%d upstream connections, want 2", n)
+	}
+}
+
+func TestHandleUpstreamError(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unreachable := "http://" + listener.Addr().String() + "/"
+	listener.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newProxyClient(t, newTestHandler(t, 5*time.Second))
+	defer client.Close()
+
+	if resp := client.get(t, unreachable, ""); resp.StatusCode != http.StatusBadGateway {
+		t.Errorf("status %d, want 502", resp.StatusCode)
+	}
+	// The client connection is still usable.
+	if resp := client.get(t, server.URL+"/", ""); resp.StatusCode != http.StatusOK {
+		t.Errorf("status %d after a failed request", resp.StatusCode)
+	}
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import "io"
+
+// tailSize bounds the read-ahead of the buffered readers on top of a
+// recorder, it must not be smaller than their buffer size.
+const tailSize = 64 << 10
+
+// recorder keeps the bytes read from a connection, so that the raw form of
+// every message can be stored. A buffered reader on top of the recorder may
+// read ahead into the next message; take splits the two.
+type recorder struct {
+	src   io.Reader
+	limit int
+	buf   []byte
+	tail  []byte
+	size  int64
+
+	stopped bool
+}
+
+func newRecorder(src io.Reader, limit int) *recorder {
+	return &recorder{
+		src:   src,
+		limit: limit,
+	}
+}
+
+func (r *recorder) Read(p []byte) (int, error) {
+	n, err := r.src.Read(p)
+	if n > 0 {
+		r.record(p[:n])
+	}
+	return n, err
+}
+
+func (r *recorder) record(p []byte) {
+	if r.stopped {
+		return
+	}
+	r.size += int64(len(p))
+
+	if room := r.limit - len(r.buf); room > 0 {
+		r.buf = append(r.buf, p[:min(room, len(p))]...)
+		p = p[min(room, len(p)):]
+	}
+
+	// Past the limit only the latest bytes are kept, as they may already
+	// belong to the next message.
+	if len(p) > 0 {
+		r.tail = append(r.tail, p...)
+		if len(r.tail) > tailSize {
+			r.tail = append(r.tail[:0], r.tail[len(r.tail)-tailSize:]...)
+		}
+	}
+}
+
+// take returns the message read so far, except for the last buffered bytes,
+// which are kept as the start of the next message. Only the first limit
+// bytes of a message are returned, truncated reports if there were more.
+func (r *recorder) take(buffered int) (raw []byte, truncated bool) {
+	length := r.size - int64(buffered)
+
+	var rest []byte
+	if length <= int64(len(r.buf)) {
+		// The next message starts in buf and may go on past the limit.
+		raw = r.buf[:length]
+		rest = append(append(rest, r.buf[length:]...), r.tail...)
+	} else {
+		raw, truncated = r.buf, true
+		if buffered <= len(r.tail) {
+			rest = r.tail[len(r.tail)-buffered:]
+		} else {
+			rest = append(r.buf[len(r.buf)-(buffered-len(r.tail)):], r.tail...)
+		}
+	}
+
+	// The rest is split at the limit again, as if it had just been read.
+	r.buf = append([]byte(nil), rest[:min(len(rest), r.limit)]...)
+	r.tail = append([]byte(nil), rest[len(r.buf):]...)
+	r.size = int64(len(rest))
+
+	return raw, truncated
+}
+
+// stop drops what was recorded and records nothing more, e.g. once the
+// connection carries a tunnel whose messages are recorded inside of it.
+func (r *recorder) stop() {
+	r.stopped = true
+	r.buf, r.tail, r.size = nil, nil, 0
+}
@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRecorderTake(t *testing.T) {
+	type message struct {
+		raw       string
+		truncated bool
+	}
+
+	tests := []struct {
+		name  string
+		limit int
+		// reads are recorded one after another, each followed by a take
+		// leaving buffered bytes unread.
+		reads    []string
+		buffered []int
+		want     []message
+	}{
+		{
+			name:     "below the limit",
+			limit:    10,
+			reads:    []string{"AAAABB", ""},
+			buffered: []int{2, 0},
+			want:     []message{{"AAAA", false}, {"BB", false}},
+		},
+		{
+			name:     "next message straddles the limit",
+			limit:    10,
+			reads:    []string{"AAAAAAAABBBBBB", ""},
+			buffered: []int{6, 0},
+			want:     []message{{"AAAAAAAA", false}, {"BBBBBB", false}},
+		},
+		{
+			name:     "message ends at the limit",
+			limit:    10,
+			reads:    []string{"AAAAAAAAAABBB", ""},
+			buffered: []int{3, 0},
+			want:     []message{{"AAAAAAAAAA", false}, {"BBB", false}},
+		},
+		{
+			name:     "message over the limit",
+			limit:    10,
+			reads:    []string{"AAAAAAAAAAAABBB", ""},
+			buffered: []int{3, 0},
+			want:     []message{{"AAAAAAAAAA", true}, {"BBB", false}},
+		},
+		{
+			name:     "next message over the limit",
+			limit:    10,
+			reads:    []string{"AAAABBBBBBBB", "BBBBCC"},
+			buffered: []int{8, 2},
+			want:     []message{{"AAAA", false}, {"BBBBBBBBBB", true}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newRecorder(nil, tt.limit)
+			for i, read := range tt.reads {
+				r.record([]byte(read))
+				raw, truncated := r.take(tt.buffered[i])
+				if string(raw) != tt.want[i].raw || truncated != tt.want[i].truncated {
+					t.Errorf("message %d = %q, %v, want %q, %v", i, raw, truncated, tt.want[i].raw, tt.want[i].truncated)
+				}
+			}
+		})
+	}
+}
+
+// TestRecorderPipelined reads pipelined requests through a buffered reader,
+// as the handler does, with bodies around the limit.
+func TestRecorderPipelined(t *testing.T) {
+	var messages []string
+	for _, size := range []int{10, 90, 100, 110, 5, 300, 1} {
+		messages = append(messages, "POST / HTTP/1.1\r\nHost: a\r\nContent-Length: "+strconv.Itoa(size)+"\r\n\r\n"+strings.Repeat("x", size))
+	}
+	const limit = 150
+
+	r := newRecorder(strings.NewReader(strings.Join(messages, "")), limit)
+	reader := bufio.NewReader(r)
+
+	for i, message := range messages {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("request %d: %v", i, err)
+		}
+		if _, err := io.Copy(io.Discard, req.Body); err != nil {
+			t.Fatal(err)
+		}
+
+		raw, truncated := r.take(reader.Buffered())
+		wantTruncated := len(message) > limit
+		want := message[:min(len(message), limit)]
+		if string(raw) != want || truncated != wantTruncated {
+			t.Errorf("request %d = %q, %v, want %q, %v", i, raw, truncated, want, wantTruncated)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"time"
+
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// timer records when the phases of an exchange with the server ended.
+type timer struct {
+	start     time.Time
+	connected time.Time
+	reused    bool
+	sent      time.Time
+	headers   time.Time
+}
+
+func newTimer() *timer {
+	return &timer{start: time.Now()}
+}
+
+// timings converts the phases to a record, the response body was received
+// completely at received.
+func (t *timer) timings(received time.Time) repo.Timings {
+	connect := float64(-1)
+	if !t.reused {
+		connect = millis(t.connected.Sub(t.start))
+	}
+
+	return repo.Timings{
+		Started: primitive.NewDateTimeFromTime(t.start),
+		Connect: connect,
+		Send:    millis(t.sent.Sub(t.connected)),
+		Wait:    millis(t.headers.Sub(t.sent)),
+		Receive: millis(received.Sub(t.headers)),
+	}
+}
+
+func millis(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
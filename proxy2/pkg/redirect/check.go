@@ -0,0 +1,107 @@
+package redirect
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"http-proxy/pkg/scanner"
+)
+
+// kPoints are the parameters which may hold redirect targets.
+var kPoints = []scanner.PointKind{scanner.PointQuery, scanner.PointForm, scanner.PointJSON}
+
+type check struct{}
+
+// NewCheck returns the check which makes the server redirect to an
+// external host.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "redirect"
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	req, err := t.Request()
+	if err != nil {
+		return nil, err
+	}
+	req.Body.Close()
+
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		name := point.Name
+		if i := strings.LastIndexAny(name, ".]"); i != -1 {
+			name = name[i+1:]
+		}
+		if !isRedirectPoint(name, point.Value) {
+			continue
+		}
+
+		host := scanner.Token() + "." + kDomain
+		for _, p := range payloads(host, req.URL.Hostname()) {
+			injected, err := t.Inject(point, p.value)
+			if err != nil {
+				return findings, err
+			}
+
+			resp, err := t.Send(injected)
+			if err != nil {
+				return findings, err
+			}
+
+			if header, value := redirected(resp, req.URL, host); header != "" {
+				findings = append(findings, scanner.Finding{
+					Name:           "Open redirect",
+					Severity:       scanner.SeverityMedium,
+					Confidence:     scanner.ConfidenceCertain,
+					Variant:        p.variant,
+					InsertionPoint: point.String(),
+					Payload:        p.value,
+					Evidence:       fmt.Sprintf("%d %s: %s", resp.StatusCode, header, value),
+					Detail:         "redirects to " + host,
+					RequestID:      resp.RequestID,
+					ResponseID:     resp.ResponseID,
+				})
+				break
+			}
+		}
+	}
+	return findings, nil
+}
+
+// redirected returns the header and its value if it redirects to host, or
+// empty strings.
+func redirected(resp *scanner.Response, base *url.URL, host string) (string, string) {
+	headers := []string{"Refresh"}
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 {
+		headers = append([]string{"Location"}, headers...)
+	}
+
+	for _, header := range headers {
+		value := resp.Header.Get(header)
+		location := value
+		if header == "Refresh" {
+			location = refreshURL(value)
+		}
+		if location == "" {
+			continue
+		}
+
+		u, err := target(base, location)
+		if err != nil {
+			continue
+		}
+		if hostname := strings.ToLower(u.Hostname()); hostname == host || strings.HasSuffix(hostname, "."+host) {
+			return header, value
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,179 @@
+package redirect
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+func TestTarget(t *testing.T) {
+	base, _ := url.Parse("https://shop.test/account/login?next=/")
+
+	tests := []struct {
+		location string
+		want     string
+	}{
+		{location: "https://evil.test/", want: "https://evil.test/"},
+		{location: "//evil.test/a", want: "https://evil.test/a"},
+		{location: `/\evil.test/`, want: "https://evil.test/"},
+		{location: `\\evil.test`, want: "https://evil.test"},
+		{location: "https:evil.test", want: "https://evil.test"},
+		{location: "HTTP:///evil.test", want: "http://evil.test"},
+		{location: " https://shop.test@evil.test/", want: "https://shop.test@evil.test/"},
+		{location: "/home", want: "https://shop.test/home"},
+		{location: "orders?id=1", want: "https://shop.test/account/orders?id=1"},
+	}
+
+	for _, tt := range tests {
+		u, err := target(base, tt.location)
+		if err != nil {
+			t.Errorf("target(%q) error = %v", tt.location, err)
+			continue
+		}
+		if u.String() != tt.want {
+			t.Errorf("target(%q) = %s, want %s", tt.location, u, tt.want)
+		}
+	}
+}
+
+func TestRefreshURL(t *testing.T) {
+	tests := []struct {
+		refresh string
+		want    string
+	}{
+		{refresh: "0; url=/next", want: "/next"},
+		{refresh: "5;URL='https://evil.test/'", want: "https://evil.test/"},
+		{refresh: "0", want: ""},
+		{refresh: "0; next", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := refreshURL(tt.refresh); got != tt.want {
+			t.Errorf("refreshURL(%q) = %q, want %q", tt.refresh, got, tt.want)
+		}
+	}
+}
+
+func TestIsRedirectPoint(t *testing.T) {
+	tests := []struct {
+		name, value string
+		want        bool
+	}{
+		{name: "next", value: "home", want: true},
+		{name: "ReturnUrl", value: "", want: true},
+		{name: "login_redirect", value: "", want: true},
+		{name: "callback_url", value: "", want: true},
+		{name: "q", value: "https://example.org/", want: true},
+		{name: "q", value: "/orders", want: true},
+		{name: "q", value: "shoes"},
+		{name: "router", value: "1"},
+	}
+
+	for _, tt := range tests {
+		if got := isRedirectPoint(tt.name, tt.value); got != tt.want {
+			t.Errorf("isRedirectPoint(%q, %q) = %v, want %v", tt.name, tt.value, got, tt.want)
+		}
+	}
+}
+
+// login redirects to the next parameter if allow accepts it, and home
+// otherwise.
+type login struct {
+	allow func(next string) bool
+	// refresh redirects through the Refresh header of a page.
+	refresh bool
+}
+
+func (l *login) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	next := r.URL.Query().Get("next")
+	if !l.allow(next) {
+		next = "/"
+	}
+
+	if l.refresh {
+		w.Header().Set("Refresh", "0; url="+next)
+		w.Write([]byte("Signed in"))
+		return
+	}
+	w.Header().Set("Location", next)
+	w.WriteHeader(http.StatusFound)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *login
+		wantVariant string
+		wantHeader  string
+	}{
+		{
+			name:        "any target",
+			server:      &login{allow: func(string) bool { return true }},
+			wantVariant: VariantAbsolute,
+			wantHeader:  "Location",
+		},
+		{
+			name:        "refresh",
+			server:      &login{allow: func(string) bool { return true }, refresh: true},
+			wantVariant: VariantAbsolute,
+			wantHeader:  "Refresh",
+		},
+		{
+			name:        "paths only",
+			server:      &login{allow: func(next string) bool { return strings.HasPrefix(next, "/") }},
+			wantVariant: VariantProtocolRelative,
+			wantHeader:  "Location",
+		},
+		{
+			name: "no protocol relative",
+			server: &login{allow: func(next string) bool {
+				return strings.HasPrefix(next, "/") && !strings.HasPrefix(next, "//")
+			}},
+			wantVariant: VariantBackslash,
+			wantHeader:  "Location",
+		},
+		{
+			name:        "own host prefix",
+			server:      &login{allow: func(next string) bool { return strings.HasPrefix(next, "https://127.0.0.1") }},
+			wantVariant: VariantUserinfo,
+			wantHeader:  "Location",
+		},
+		{
+			name: "local only",
+			server: &login{allow: func(next string) bool {
+				u, err := target(&url.URL{Scheme: "http", Host: "127.0.0.1"}, next)
+				return err == nil && u.Hostname() == "127.0.0.1"
+			}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			target, _ := scannertest.NewTarget(http.MethodGet, server.URL+"/login?next=/account", nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+				return
+			}
+			if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:next" {
+				t.Fatalf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+			if !strings.Contains(findings[0].Evidence, tt.wantHeader+": ") {
+				t.Errorf("evidence = %q, want the %s header", findings[0].Evidence, tt.wantHeader)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Package redirect finds open redirects by injecting external URLs into
+// parameters which look like redirect targets.
+package redirect
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const (
+	VariantAbsolute         = "absolute"
+	VariantProtocolRelative = "protocol_relative"
+	VariantBackslash        = "backslash"
+	VariantMissingSlashes   = "missing_slashes"
+	VariantUserinfo         = "userinfo"
+	VariantSubdomain        = "subdomain"
+)
+
+// kDomain is the reserved domain under which payloads name a random host.
+const kDomain = "example.com"
+
+var (
+	// kNames match parameter names of redirect targets.
+	kNames = regexp.MustCompile(`(?i)^(?:redirect|redir|next|url|uri|return|returnto|return_?url|goto|go|dest|destination|continue|target|to|out|forward|callback|link|location|success|r|u)$|redirect|return_?to|_url$`)
+	// kValues match values which are URLs or absolute paths.
+	kValues = regexp.MustCompile(`(?i)^(?:https?:|//|/)`)
+	// kScheme matches schemes followed by any number of slashes.
+	kScheme = regexp.MustCompile(`(?i)^(https?):/*`)
+)
+
+// payload is a URL leading to host.
+type payload struct {
+	variant string
+	value   string
+}
+
+// payloads returns URLs of host, some of which pass validations allowing
+// only the scanned host or relative paths.
+func payloads(host, scannedHost string) []payload {
+	return []payload{
+		{VariantAbsolute, "https://" + host + "/"},
+		{VariantProtocolRelative, "//" + host + "/"},
+		{VariantBackslash, `/\` + host + "/"},
+		{VariantMissingSlashes, "https:" + host},
+		{VariantUserinfo, "https://" + scannedHost + "@" + host + "/"},
+		{VariantSubdomain, "https://" + scannedHost + "." + host + "/"},
+	}
+}
+
+// isRedirectPoint tells whether a parameter looks like a redirect target.
+func isRedirectPoint(name, value string) bool {
+	return kNames.MatchString(name) || kValues.MatchString(value)
+}
+
+// target resolves a redirect location against the request URL the way
+// browsers do, which treat backslashes as slashes and add missing slashes
+// after the scheme.
+func target(base *url.URL, location string) (*url.URL, error) {
+	location = strings.ReplaceAll(strings.TrimSpace(location), `\`, "/")
+	if loc := kScheme.FindStringSubmatchIndex(location); loc != nil {
+		location = location[loc[2]:loc[3]] + "://" + location[loc[1]:]
+	}
+	return base.Parse(location)
+}
+
+// refreshURL returns the URL of a Refresh header like "0; url=/next".
+func refreshURL(refresh string) string {
+	_, rest, ok := strings.Cut(refresh, ";")
+	if !ok {
+		return ""
+	}
+	rest = strings.TrimSpace(rest)
+	if len(rest) < 4 || !strings.EqualFold(rest[:4], "url=") {
+		return ""
+	}
+	return strings.Trim(rest[4:], `'" `)
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import "regexp"
+
+// LocalFile is a file read by injected payloads, recognized by a signature
+// of its content.
+type LocalFile struct {
+	Path    string
+	Windows bool
+	// Signature is nil for files without known content, which are found
+	// only where a check can locate them, e.g. between markers.
+	Signature *regexp.Regexp
+}
+
+var (
+	Passwd   = LocalFile{Path: "/etc/passwd", Signature: regexp.MustCompile(`root:[^:\r\n]*:0:0:`)}
+	Hostname = LocalFile{Path: "/etc/hostname"}
+	WinIni   = LocalFile{
+		Path:      "c:/windows/win.ini",
+		Windows:   true,
+		Signature: regexp.MustCompile(`; for 16-bit app support|\[(?:fonts|extensions|mci extensions)\]`),
+	}
+)
+
+// URL returns the file URL of the file.
+func (f LocalFile) URL() string {
+	if f.Windows {
+		return "file:///" + f.Path
+	}
+	return "file://" + f.Path
+}
+
+// Find returns the evidence of the file in body, or an empty string if its
+// signature is not in body or already was in the baseline.
+func (f LocalFile) Find(body, baseline []byte) string {
+	if f.Signature == nil {
+		return ""
+	}
+
+	loc := f.Signature.FindIndex(body)
+	if loc == nil || f.Signature.Match(baseline) {
+		return ""
+	}
+	return Excerpt(body, loc[0], loc[1]-loc[0])
+}
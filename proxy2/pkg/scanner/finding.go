@@ -0,0 +1,58 @@
+package scanner
+
+import "bytes"
+
+type Severity string
+
+const (
+	SeverityInfo   Severity = "info"
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Confidence tells how likely a finding is a real vulnerability.
+type Confidence string
+
+const (
+	ConfidenceTentative Confidence = "tentative"
+	ConfidenceFirm      Confidence = "firm"
+	ConfidenceCertain   Confidence = "certain"
+)
+
+// Finding is a vulnerability found by a check. Variant tells which technique
+// of the check found it. RequestID and ResponseID identify the stored
+// exchange which shows it and can be repeated.
+type Finding struct {
+	Check          string     `json:"check"`
+	Name           string     `json:"name"`
+	Severity       Severity   `json:"severity"`
+	Confidence     Confidence `json:"confidence"`
+	Variant        string     `json:"variant,omitempty"`
+	InsertionPoint string     `json:"insertion_point,omitempty"`
+	Payload        string     `json:"payload,omitempty"`
+	Evidence       string     `json:"evidence,omitempty"`
+	Detail         string     `json:"detail,omitempty"`
+	RequestID      string     `json:"request_id,omitempty"`
+	ResponseID     string     `json:"response_id,omitempty"`
+}
+
+// evidenceContext is the number of bytes kept around a match.
+const evidenceContext = 60
+
+// Evidence returns the part of body around the first occurrence of match,
+// or an empty string if it does not occur.
+func Evidence(body, match []byte) string {
+	idx := bytes.Index(body, match)
+	if idx == -1 {
+		return ""
+	}
+	return Excerpt(body, idx, len(match))
+}
+
+// Excerpt returns body[idx:idx+n] with some context on both sides.
+func Excerpt(body []byte, idx, n int) string {
+	start := max(idx-evidenceContext, 0)
+	end := min(idx+n+evidenceContext, len(body))
+	return string(body[start:end])
+}
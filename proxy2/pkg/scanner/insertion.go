@@ -0,0 +1,333 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+type PointKind string
+
+const (
+	PointQuery        PointKind = "query"
+	PointForm         PointKind = "form"
+	PointJSON         PointKind = "json"
+	PointXML          PointKind = "xml"
+	PointXMLAttribute PointKind = "xml_attribute"
+	PointCookie       PointKind = "cookie"
+	PointHeader       PointKind = "header"
+	PointPath         PointKind = "path"
+	PointMultipart    PointKind = "multipart"
+)
+
+// injectableHeaders are the request headers used as insertion points if
+// present. Others, e.g. Host, rarely reach the application unchanged.
+var injectableHeaders = []string{"User-Agent", "Referer", "X-Forwarded-For", "X-Forwarded-Host", "Origin"}
+
+// InsertionPoint is a place in a request where checks put their payloads.
+// It is found in one request and applies to copies of the same request.
+type InsertionPoint struct {
+	Kind PointKind `json:"kind"`
+	// Name is the parameter, cookie or header name, the position of a path
+	// segment, a JSON path like "user.tags[0]" or an XML path like
+	// "/order/item/@id".
+	Name string `json:"name"`
+	// Value is the value of the point in the original request.
+	Value string `json:"value"`
+	// Filename is the name of an uploaded file.
+	Filename string `json:"filename,omitempty"`
+
+	// index is the position among the pairs, segments or parts of the
+	// request, for cookies the occurrence of the name, as the order of
+	// cookies may change when the request is rebuilt. start and end are the
+	// byte range of an XML value.
+	index int
+	path  []interface{}
+	start int
+	end   int
+}
+
+func (p *InsertionPoint) String() string {
+	return string(p.Kind) + ":" + p.Name
+}
+
+// Inject sets the value of the point in req, encoded as its position
+// requires, e.g. URL encoded in the query or escaped in XML.
+func (p *InsertionPoint) Inject(req *http.Request, value string) error {
+	return p.inject(req, value, false)
+}
+
+// InjectRaw inserts raw verbatim, e.g. an already encoded value into the
+// query. In JSON raw must be a JSON value.
+func (p *InsertionPoint) InjectRaw(req *http.Request, raw string) error {
+	return p.inject(req, raw, true)
+}
+
+func (p *InsertionPoint) inject(req *http.Request, value string, raw bool) error {
+	switch p.Kind {
+	case PointQuery:
+		req.URL.RawQuery = replacePair(req.URL.RawQuery, "&", p.index, encodeValue(value, raw))
+		return nil
+	case PointCookie:
+		cookie, err := replaceCookie(req.Header.Values("Cookie"), p.Name, p.index, encodeValue(value, raw))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Cookie", cookie)
+		return nil
+	case PointHeader:
+		req.Header.Set(p.Name, value)
+		return nil
+	case PointPath:
+		if !raw {
+			value = url.PathEscape(value)
+		}
+		segments := strings.Split(req.URL.EscapedPath(), "/")
+		segments[p.index] = value
+		req.URL.Opaque = strings.Join(segments, "/")
+		return nil
+	}
+
+	body, err := ReadBody(req)
+	if err != nil {
+		return err
+	}
+
+	switch p.Kind {
+	case PointForm:
+		body = []byte(replacePair(string(body), "&", p.index, encodeValue(value, raw)))
+	case PointJSON:
+		body, err = injectJSON(body, p.path, value, raw)
+	case PointXML, PointXMLAttribute:
+		body = injectXML(body, p.start, p.end, value, raw)
+	case PointMultipart:
+		body, err = injectMultipart(req.Header.Get("Content-Type"), body, p.index, value)
+	}
+	if err != nil {
+		return err
+	}
+
+	SetBody(req, body)
+	return nil
+}
+
+// InsertionPoints enumerates the insertion points of a request, leaving its
+// body readable.
+func InsertionPoints(req *http.Request) ([]*InsertionPoint, error) {
+	body, err := ReadBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var points []*InsertionPoint
+
+	for i, segment := range strings.Split(req.URL.EscapedPath(), "/") {
+		if segment == "" {
+			continue
+		}
+		value, err := url.PathUnescape(segment)
+		if err != nil {
+			value = segment
+		}
+		points = append(points, &InsertionPoint{Kind: PointPath, Name: strconv.Itoa(i), Value: value, index: i})
+	}
+
+	points = append(points, pairPoints(PointQuery, req.URL.RawQuery, "&")...)
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	switch {
+	case mediaType == "application/x-www-form-urlencoded":
+		points = append(points, pairPoints(PointForm, string(body), "&")...)
+	case mediaType == "multipart/form-data":
+		points = append(points, multipartPoints(req.Header.Get("Content-Type"), body)...)
+	case isJSON(mediaType, body):
+		points = append(points, jsonPoints(body)...)
+	case isXML(mediaType, body):
+		points = append(points, xmlPoints(body)...)
+	}
+
+	points = append(points, pairPoints(PointCookie, strings.Join(req.Header.Values("Cookie"), "; "), ";")...)
+
+	for _, name := range injectableHeaders {
+		if value := req.Header.Get(name); value != "" {
+			points = append(points, &InsertionPoint{Kind: PointHeader, Name: name, Value: value})
+		}
+	}
+
+	return points, nil
+}
+
+// FilterPoints returns the points of the given kinds.
+func FilterPoints(points []*InsertionPoint, kinds ...PointKind) []*InsertionPoint {
+	if len(kinds) == 0 {
+		return points
+	}
+
+	var filtered []*InsertionPoint
+	for _, point := range points {
+		if slices.Contains(kinds, point.Kind) {
+			filtered = append(filtered, point)
+		}
+	}
+	return filtered
+}
+
+// WriteRequest writes req like Request.Write, except that line breaks in
+// header values are kept, which Write replaces with spaces. Checks inject
+// them on purpose.
+func WriteRequest(w io.Writer, req *http.Request) error {
+	header := req.Header
+	defer func() { req.Header = header }()
+
+	var broken []string
+	req.Header = make(http.Header, len(header))
+	for name, values := range header {
+		if slices.ContainsFunc(values, func(v string) bool { return strings.ContainsAny(v, "\r\n") }) {
+			broken = append(broken, name)
+			// An empty User-Agent stops Write from adding its own.
+			if name == "User-Agent" {
+				req.Header[name] = nil
+			}
+		} else {
+			req.Header[name] = values
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := req.Write(&buf); err != nil {
+		return err
+	}
+	if len(broken) == 0 {
+		_, err := buf.WriteTo(w)
+		return err
+	}
+
+	var lines bytes.Buffer
+	slices.Sort(broken)
+	for _, name := range broken {
+		for _, value := range header[name] {
+			lines.WriteString(name + ": " + value + "\r\n")
+		}
+	}
+
+	raw := buf.Bytes()
+	end := bytes.Index(raw, []byte("\r\n\r\n")) + 2
+	_, err := w.Write(slices.Concat(raw[:end], lines.Bytes(), raw[end:]))
+	return err
+}
+
+// SetBody replaces the body of req.
+func SetBody(req *http.Request, body []byte) {
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.TransferEncoding = nil
+}
+
+// ReadBody reads the body of req and replaces it with a fresh reader.
+func ReadBody(req *http.Request) ([]byte, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil, nil
+	}
+
+	body, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	SetBody(req, body)
+	return body, nil
+}
+
+// pairPoints splits name=value pairs like a query string or a Cookie header.
+func pairPoints(kind PointKind, s, sep string) []*InsertionPoint {
+	if s == "" {
+		return nil
+	}
+
+	var points []*InsertionPoint
+	occurrences := make(map[string]int)
+	for i, pair := range strings.Split(s, sep) {
+		name, value, _ := strings.Cut(strings.TrimSpace(pair), "=")
+		if name == "" {
+			continue
+		}
+
+		index := i
+		if kind == PointCookie {
+			index = occurrences[name]
+			occurrences[name]++
+		} else {
+			name, value = unescapeQuery(name), unescapeQuery(value)
+		}
+		points = append(points, &InsertionPoint{Kind: kind, Name: name, Value: value, index: index})
+	}
+	return points
+}
+
+func unescapeQuery(s string) string {
+	if unescaped, err := url.QueryUnescape(s); err == nil {
+		return unescaped
+	}
+	return s
+}
+
+func replacePair(s, sep string, index int, value string) string {
+	pairs := strings.Split(s, sep)
+	setPairValue(pairs, index, value)
+	return strings.Join(pairs, sep)
+}
+
+// replaceCookie sets the value of the occurrence of the named cookie.
+func replaceCookie(headers []string, name string, occurrence int, value string) (string, error) {
+	pairs := strings.Split(strings.Join(headers, "; "), ";")
+	for i := range pairs {
+		pairs[i] = strings.TrimSpace(pairs[i])
+	}
+
+	for i := range pairs {
+		if pairName, _, _ := strings.Cut(pairs[i], "="); pairName != name {
+			continue
+		}
+		if occurrence == 0 {
+			setPairValue(pairs, i, value)
+			return strings.Join(pairs, "; "), nil
+		}
+		occurrence--
+	}
+	return "", fmt.Errorf("cookie %s not found", name)
+}
+
+func setPairValue(pairs []string, index int, value string) {
+	name, _, _ := strings.Cut(pairs[index], "=")
+	pairs[index] = name + "=" + value
+}
+
+func encodeValue(value string, raw bool) string {
+	if raw {
+		return value
+	}
+	return url.QueryEscape(value)
+}
+
+func isJSON(mediaType string, body []byte) bool {
+	if strings.HasSuffix(mediaType, "json") {
+		return true
+	}
+	body = bytes.TrimSpace(body)
+	return len(body) != 0 && (body[0] == '{' || body[0] == '[')
+}
+
+func isXML(mediaType string, body []byte) bool {
+	if strings.HasSuffix(mediaType, "xml") {
+		return true
+	}
+	body = bytes.TrimSpace(body)
+	return len(body) != 0 && body[0] == '<'
+}
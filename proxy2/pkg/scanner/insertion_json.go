@@ -0,0 +1,137 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+)
+
+// jsonPoints returns a point for every scalar value in a JSON document.
+func jsonPoints(body []byte) []*InsertionPoint {
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil
+	}
+
+	var points []*InsertionPoint
+	var walk func(value interface{}, path []interface{})
+	walk = func(value interface{}, path []interface{}) {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			for _, key := range slices.Sorted(maps.Keys(v)) {
+				walk(v[key], append(slices.Clip(path), key))
+			}
+		case []interface{}:
+			for i, item := range v {
+				walk(item, append(slices.Clip(path), i))
+			}
+		default:
+			points = append(points, &InsertionPoint{
+				Kind:  PointJSON,
+				Name:  jsonPath(path),
+				Value: jsonScalar(v),
+				path:  path,
+			})
+		}
+	}
+	walk(doc, nil)
+
+	return points
+}
+
+// injectJSON replaces the value at path with a string, or with a raw JSON
+// value.
+func injectJSON(body []byte, path []interface{}, value string, raw bool) ([]byte, error) {
+	doc, err := decodeJSON(body)
+	if err != nil {
+		return nil, err
+	}
+
+	var replacement interface{} = value
+	if raw {
+		replacement = json.RawMessage(value)
+	}
+
+	if len(path) == 0 {
+		doc = replacement
+	} else {
+		parent := doc
+		for _, key := range path[:len(path)-1] {
+			if parent, err = jsonChild(parent, key); err != nil {
+				return nil, err
+			}
+		}
+
+		switch container := parent.(type) {
+		case map[string]interface{}:
+			container[path[len(path)-1].(string)] = replacement
+		case []interface{}:
+			container[path[len(path)-1].(int)] = replacement
+		}
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+func decodeJSON(body []byte) (interface{}, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+
+	var doc interface{}
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func jsonChild(value interface{}, key interface{}) (interface{}, error) {
+	switch container := value.(type) {
+	case map[string]interface{}:
+		if k, ok := key.(string); ok {
+			return container[k], nil
+		}
+	case []interface{}:
+		if i, ok := key.(int); ok && i < len(container) {
+			return container[i], nil
+		}
+	}
+	return nil, fmt.Errorf("no JSON value at %v", key)
+}
+
+func jsonPath(path []interface{}) string {
+	var buf bytes.Buffer
+	for _, key := range path {
+		switch k := key.(type) {
+		case string:
+			if buf.Len() != 0 {
+				buf.WriteByte('.')
+			}
+			buf.WriteString(k)
+		case int:
+			buf.WriteString("[" + strconv.Itoa(k) + "]")
+		}
+	}
+	if buf.Len() == 0 {
+		return "$"
+	}
+	return buf.String()
+}
+
+func jsonScalar(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return "null"
+	}
+	return fmt.Sprint(value)
+}
@@ -0,0 +1,104 @@
+package scanner
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+)
+
+type multipartPart struct {
+	header   map[string][]string
+	name     string
+	filename string
+	content  []byte
+}
+
+// multipartPoints returns a point for the content of every part.
+func multipartPoints(contentType string, body []byte) []*InsertionPoint {
+	parts, err := readMultipart(contentType, body)
+	if err != nil {
+		return nil
+	}
+
+	points := make([]*InsertionPoint, 0, len(parts))
+	for i, part := range parts {
+		points = append(points, &InsertionPoint{
+			Kind:     PointMultipart,
+			Name:     part.name,
+			Value:    string(part.content),
+			Filename: part.filename,
+			index:    i,
+		})
+	}
+	return points
+}
+
+// injectMultipart rebuilds the body with the content of one part replaced.
+func injectMultipart(contentType string, body []byte, index int, value string) ([]byte, error) {
+	parts, err := readMultipart(contentType, body)
+	if err != nil {
+		return nil, err
+	}
+	if index >= len(parts) {
+		return nil, errors.New("multipart part not found")
+	}
+	parts[index].content = []byte(value)
+
+	_, params, _ := mime.ParseMediaType(contentType)
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	if err := writer.SetBoundary(params["boundary"]); err != nil {
+		return nil, err
+	}
+
+	for _, part := range parts {
+		w, err := writer.CreatePart(part.header)
+		if err != nil {
+			return nil, err
+		}
+		w.Write(part.content)
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readMultipart(contentType string, body []byte) ([]*multipartPart, error) {
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, err
+	}
+	if params["boundary"] == "" {
+		return nil, errors.New("multipart boundary missing")
+	}
+
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+
+	var parts []*multipartPart
+	for {
+		part, err := reader.NextRawPart()
+		if errors.Is(err, io.EOF) {
+			return parts, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return nil, err
+		}
+
+		parts = append(parts, &multipartPart{
+			header:   part.Header,
+			name:     part.FormName(),
+			filename: part.FileName(),
+			content:  content,
+		})
+	}
+}
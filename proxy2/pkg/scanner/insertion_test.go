@@ -0,0 +1,316 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+const testBoundary = "testboundary"
+
+// multipartBody returns a form with a field and an uploaded file.
+func multipartBody(field, file string) string {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	writer.SetBoundary(testBoundary)
+	writer.WriteField("name", field)
+	w, _ := writer.CreateFormFile("upload", "a.txt")
+	w.Write([]byte(file))
+	writer.Close()
+	return buf.String()
+}
+
+func TestInsertionPoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		method string
+		target string
+		header http.Header
+		body   string
+
+		wantPoints []string
+
+		// point is injected with value, and the request must then have
+		// wantURI, wantBody, or the original body if empty, and wantHeader.
+		point      string
+		value      string
+		raw        bool
+		wantURI    string
+		wantBody   string
+		wantHeader http.Header
+	}{
+		{
+			name:       "query",
+			method:     http.MethodGet,
+			target:     "/search?q=a+b&page=2",
+			wantPoints: []string{"path:1=search", "query:q=a b", "query:page=2"},
+			point:      "query:q",
+			value:      "x&y",
+			wantURI:    "/search?q=x%26y&page=2",
+		},
+		{
+			name:       "query raw",
+			method:     http.MethodGet,
+			target:     "/search?q=a+b&page=2",
+			wantPoints: []string{"path:1=search", "query:q=a b", "query:page=2"},
+			point:      "query:page",
+			value:      "%0d%0a",
+			raw:        true,
+			wantURI:    "/search?q=a+b&page=%0d%0a",
+		},
+		{
+			name:       "form",
+			method:     http.MethodPost,
+			target:     "/login",
+			header:     http.Header{"Content-Type": {"application/x-www-form-urlencoded"}},
+			body:       "user=bob&note=hi%21",
+			wantPoints: []string{"path:1=login", "form:user=bob", "form:note=hi!"},
+			point:      "form:note",
+			value:      "<a>",
+			wantURI:    "/login",
+			wantBody:   "user=bob&note=%3Ca%3E",
+		},
+		{
+			name:       "json",
+			method:     http.MethodPost,
+			target:     "/",
+			header:     http.Header{"Content-Type": {"application/json"}},
+			body:       `{"user":{"name":"bob","tags":["a",1]},"ok":true}`,
+			wantPoints: []string{"json:ok=true", "json:user.name=bob", "json:user.tags[0]=a", "json:user.tags[1]=1"},
+			point:      "json:user.tags[1]",
+			value:      `<x">`,
+			wantURI:    "/",
+			wantBody:   `{"ok":true,"user":{"name":"bob","tags":["a","<x\">"]}}`,
+		},
+		{
+			name:       "json raw",
+			method:     http.MethodPost,
+			target:     "/",
+			header:     http.Header{"Content-Type": {"application/json"}},
+			body:       `{"user":{"name":"bob","tags":["a",1]},"ok":true}`,
+			wantPoints: []string{"json:ok=true", "json:user.name=bob", "json:user.tags[0]=a", "json:user.tags[1]=1"},
+			point:      "json:user.name",
+			value:      `{"$ne":null}`,
+			raw:        true,
+			wantURI:    "/",
+			wantBody:   `{"ok":true,"user":{"name":{"$ne":null},"tags":["a",1]}}`,
+		},
+		{
+			name:       "xml",
+			method:     http.MethodPost,
+			target:     "/",
+			header:     http.Header{"Content-Type": {"text/xml"}},
+			body:       `<order id="7" xmlns="urn:x"><item>a&amp;b</item><empty/></order>`,
+			wantPoints: []string{"xml_attribute:/order/@id=7", "xml:/order/item=a&amp;b"},
+			point:      "xml:/order/item",
+			value:      "<x>",
+			wantURI:    "/",
+			wantBody:   `<order id="7" xmlns="urn:x"><item>&lt;x&gt;</item><empty/></order>`,
+		},
+		{
+			name:       "xml attribute",
+			method:     http.MethodPost,
+			target:     "/",
+			body:       `<order id='7'><item>a</item></order>`,
+			wantPoints: []string{"xml_attribute:/order/@id=7", "xml:/order/item=a"},
+			point:      "xml_attribute:/order/@id",
+			value:      "8",
+			wantURI:    "/",
+			wantBody:   `<order id='8'><item>a</item></order>`,
+		},
+		{
+			name:       "cookie",
+			method:     http.MethodGet,
+			target:     "/",
+			header:     http.Header{"Cookie": {"session=abc; theme=dark"}},
+			wantPoints: []string{"cookie:session=abc", "cookie:theme=dark"},
+			point:      "cookie:theme",
+			value:      "a b;",
+			wantURI:    "/",
+			wantHeader: http.Header{"Cookie": {"session=abc; theme=a+b%3B"}},
+		},
+		{
+			name:       "header",
+			method:     http.MethodGet,
+			target:     "/",
+			header:     http.Header{"User-Agent": {"curl"}, "X-Custom": {"ignored"}, "Referer": {"http://example.com/"}},
+			wantPoints: []string{"header:User-Agent=curl", "header:Referer=http://example.com/"},
+			point:      "header:Referer",
+			value:      "http://evil.test/",
+			wantURI:    "/",
+			wantHeader: http.Header{"Referer": {"http://evil.test/"}, "User-Agent": {"curl"}},
+		},
+		{
+			name:       "path",
+			method:     http.MethodGet,
+			target:     "/users/42/profile%20x?tab=1",
+			wantPoints: []string{"path:1=users", "path:2=42", "path:3=profile x", "query:tab=1"},
+			point:      "path:2",
+			value:      "../a b",
+			wantURI:    "/users/..%2Fa%20b/profile%20x?tab=1",
+		},
+		{
+			name:       "multipart",
+			method:     http.MethodPost,
+			target:     "/",
+			header:     http.Header{"Content-Type": {"multipart/form-data; boundary=" + testBoundary}},
+			body:       multipartBody("bob", "hello"),
+			wantPoints: []string{"multipart:name=bob", "multipart:upload=hello (a.txt)"},
+			point:      "multipart:name",
+			value:      "x\r\n--" + testBoundary,
+			wantURI:    "/",
+			wantBody:   multipartBody("x\r\n--"+testBoundary, "hello"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			newRequest := func() *http.Request {
+				req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body))
+				for name, values := range tt.header {
+					req.Header[name] = values
+				}
+				return req
+			}
+
+			req := newRequest()
+			points, err := InsertionPoints(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, _ := ReadBody(req); string(body) != tt.body {
+				t.Errorf("body after enumeration = %q", body)
+			}
+
+			var got []string
+			var point *InsertionPoint
+			for _, p := range points {
+				s := p.String() + "=" + p.Value
+				if p.Filename != "" {
+					s += fmt.Sprintf(" (%s)", p.Filename)
+				}
+				got = append(got, s)
+				if p.String() == tt.point {
+					point = p
+				}
+			}
+			if !slices.Equal(got, tt.wantPoints) {
+				t.Fatalf("points = %q, want %q", got, tt.wantPoints)
+			}
+			if point == nil {
+				t.Fatalf("no point %s", tt.point)
+			}
+
+			req = newRequest()
+			if tt.raw {
+				err = point.InjectRaw(req, tt.value)
+			} else {
+				err = point.Inject(req, tt.value)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if uri := req.URL.RequestURI(); uri != tt.wantURI {
+				t.Errorf("URI = %q, want %q", uri, tt.wantURI)
+			}
+			wantBody := tt.wantBody
+			if wantBody == "" {
+				wantBody = tt.body
+			}
+			body, _ := ReadBody(req)
+			if string(body) != wantBody {
+				t.Errorf("body = %q, want %q", body, wantBody)
+			}
+			if req.ContentLength != int64(len(body)) {
+				t.Errorf("Content-Length = %d for %d bytes", req.ContentLength, len(body))
+			}
+			for name, values := range tt.wantHeader {
+				if got := req.Header.Values(name); !slices.Equal(got, values) {
+					t.Errorf("%s = %q, want %q", name, got, values)
+				}
+			}
+		})
+	}
+}
+
+func TestFilterPoints(t *testing.T) {
+	points := []*InsertionPoint{{Kind: PointQuery, Name: "q"}, {Kind: PointCookie, Name: "c"}, {Kind: PointPath, Name: "1"}}
+
+	if got := FilterPoints(points); len(got) != 3 {
+		t.Errorf("no kinds kept %d points", len(got))
+	}
+
+	var got []string
+	for _, p := range FilterPoints(points, PointPath, PointQuery) {
+		got = append(got, p.String())
+	}
+	if want := []string{"query:q", "path:1"}; !slices.Equal(got, want) {
+		t.Errorf("points = %q, want %q", got, want)
+	}
+}
+
+func TestInjectCookie(t *testing.T) {
+	tests := []struct {
+		name string
+		// cookie is enumerated, injected is injected at the second point.
+		cookie   string
+		injected string
+		want     string
+	}{
+		{name: "same order", cookie: "a=1; b=2; c=3", injected: "a=1; b=2; c=3", want: "a=1; b=x; c=3"},
+		{name: "reordered", cookie: "a=1; b=2; c=3", injected: "c=3; a=1; b=2", want: "c=3; a=1; b=x"},
+		{name: "repeated name", cookie: "a=1; a=2; b=3", injected: "b=3; a=1; a=2", want: "b=3; a=1; a=x"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Cookie", tt.cookie)
+			points, err := InsertionPoints(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			req.Header.Set("Cookie", tt.injected)
+			if err := points[1].Inject(req, "x"); err != nil {
+				t.Fatal(err)
+			}
+			if got := req.Header.Get("Cookie"); got != tt.want {
+				t.Errorf("Cookie = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	point := &InsertionPoint{Kind: PointCookie, Name: "gone"}
+	if err := point.Inject(req, "x"); err == nil {
+		t.Error("injected into a missing cookie")
+	}
+}
+
+func TestWriteRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "http://example.com/a", strings.NewReader("body"))
+	req.Header.Set("Referer", "http://example.com/\r\nX-Injected: 1")
+	req.Header.Set("User-Agent", "agent\nX-Agent: 2")
+	req.Header.Set("Accept", "*/*")
+
+	var buf bytes.Buffer
+	if err := WriteRequest(&buf, req); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "POST /a HTTP/1.1\r\nHost: example.com\r\nContent-Length: 4\r\nAccept: */*\r\n" +
+		"Referer: http://example.com/\r\nX-Injected: 1\r\nUser-Agent: agent\nX-Agent: 2\r\n\r\nbody"
+	if buf.String() != want {
+		t.Errorf("request = %q, want %q", buf.String(), want)
+	}
+	if req.Header.Get("Referer") != "http://example.com/\r\nX-Injected: 1" || len(req.Header) != 3 {
+		t.Errorf("header changed: %q", req.Header)
+	}
+}
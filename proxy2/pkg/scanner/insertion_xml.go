@@ -0,0 +1,122 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/xml"
+	"regexp"
+	"strings"
+)
+
+var xmlAttribute = regexp.MustCompile(`\s([^\s=/>]+)\s*=\s*(?:"([^"]*)"|'([^']*)')`)
+
+type xmlElement struct {
+	name         string
+	contentStart int
+	hasChildren  bool
+	selfClosing  bool
+}
+
+// xmlPoints returns a point for the content of every element without child
+// elements and for every attribute. Parsing stops at the first error.
+func xmlPoints(body []byte) []*InsertionPoint {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
+
+	var points []*InsertionPoint
+	var stack []*xmlElement
+
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err != nil {
+			return points
+		}
+		end := int(decoder.InputOffset())
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if len(stack) != 0 {
+				stack[len(stack)-1].hasChildren = true
+			}
+			element := &xmlElement{
+				name:         xmlPath(stack) + "/" + xmlName(t.Name),
+				contentStart: end,
+				selfClosing:  bytes.HasSuffix(body[start:end], []byte("/>")),
+			}
+			stack = append(stack, element)
+
+			for _, match := range xmlAttribute.FindAllSubmatchIndex(body[start:end], -1) {
+				name := string(body[start+match[2] : start+match[3]])
+				if name == "xmlns" || strings.HasPrefix(name, "xmlns:") {
+					continue
+				}
+				valueStart, valueEnd := match[4], match[5]
+				if valueStart == -1 {
+					valueStart, valueEnd = match[6], match[7]
+				}
+				points = append(points, &InsertionPoint{
+					Kind:  PointXMLAttribute,
+					Name:  element.name + "/@" + name,
+					Value: string(body[start+valueStart : start+valueEnd]),
+					start: start + valueStart,
+					end:   start + valueEnd,
+				})
+			}
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return points
+			}
+			element := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+
+			if !element.hasChildren && !element.selfClosing {
+				points = append(points, &InsertionPoint{
+					Kind:  PointXML,
+					Name:  element.name,
+					Value: string(body[element.contentStart:start]),
+					start: element.contentStart,
+					end:   start,
+				})
+			}
+		}
+	}
+}
+
+// ReplaceXMLText replaces the content of every element without child
+// elements with raw.
+func ReplaceXMLText(body []byte, raw string) []byte {
+	points := FilterPoints(xmlPoints(body), PointXML)
+	for i := len(points) - 1; i >= 0; i-- {
+		body = injectXML(body, points[i].start, points[i].end, raw, true)
+	}
+	return body
+}
+
+// injectXML replaces body[start:end], escaping the value unless raw is set.
+func injectXML(body []byte, start, end int, value string, raw bool) []byte {
+	if !raw {
+		var buf bytes.Buffer
+		xml.EscapeText(&buf, []byte(value))
+		value = buf.String()
+	}
+
+	injected := make([]byte, 0, len(body)-(end-start)+len(value))
+	injected = append(injected, body[:start]...)
+	injected = append(injected, value...)
+	return append(injected, body[end:]...)
+}
+
+func xmlPath(stack []*xmlElement) string {
+	if len(stack) == 0 {
+		return ""
+	}
+	return stack[len(stack)-1].name
+}
+
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
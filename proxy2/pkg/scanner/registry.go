@@ -0,0 +1,80 @@
+package scanner
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Registry holds the available checks and the ones run by default.
+type Registry struct {
+	checks  []Check
+	enabled []Check
+}
+
+// NewRegistry registers the checks and enables all of them.
+func NewRegistry(checks ...Check) *Registry {
+	r := &Registry{}
+	for _, check := range checks {
+		r.Register(check)
+	}
+	return r
+}
+
+// Register adds an enabled check, replacing one with the same name.
+func (r *Registry) Register(check Check) {
+	r.checks = replaceCheck(r.checks, check)
+	r.enabled = replaceCheck(r.enabled, check)
+}
+
+func replaceCheck(checks []Check, check Check) []Check {
+	idx := slices.IndexFunc(checks, func(c Check) bool { return c.Name() == check.Name() })
+	if idx == -1 {
+		return append(checks, check)
+	}
+	checks[idx] = check
+	return checks
+}
+
+// Names returns the names of all registered checks.
+func (r *Registry) Names() []string {
+	names := make([]string, len(r.checks))
+	for i, check := range r.checks {
+		names[i] = check.Name()
+	}
+	return names
+}
+
+// Enable restricts the checks run by default to the named ones, an empty
+// list enables all.
+func (r *Registry) Enable(names []string) error {
+	if len(names) == 0 {
+		r.enabled = slices.Clone(r.checks)
+		return nil
+	}
+
+	checks, err := r.Select(names)
+	if err != nil {
+		return err
+	}
+	r.enabled = checks
+	return nil
+}
+
+// Select returns the named checks, or the enabled ones if names is empty.
+// Disabled checks can be selected by name.
+func (r *Registry) Select(names []string) ([]Check, error) {
+	if len(names) == 0 {
+		return slices.Clone(r.enabled), nil
+	}
+
+	var checks []Check
+	for _, name := range names {
+		idx := slices.IndexFunc(r.checks, func(c Check) bool { return c.Name() == name })
+		if idx == -1 {
+			return nil, fmt.Errorf("unknown check %q, expected one of %s", name, strings.Join(r.Names(), ", "))
+		}
+		checks = replaceCheck(checks, r.checks[idx])
+	}
+	return checks, nil
+}
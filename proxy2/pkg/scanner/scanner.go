@@ -0,0 +1,240 @@
+// Package scanner runs active checks against stored requests. Every check
+// lives in its own package, e.g. pkg/xxe, and sends modified copies of the
+// scanned request through a Target, which stores them linked to it.
+package scanner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"http-proxy/pkg/oob"
+	"http-proxy/repo"
+)
+
+// Check looks for one class of vulnerabilities.
+type Check interface {
+	// Name identifies the check in the registry and in findings.
+	Name() string
+	// Scan sends the requests of the check and reports what they found.
+	// Requests which cannot be built for the target, e.g. because it has
+	// no XML body, are skipped without an error.
+	Scan(t *Target) ([]Finding, error)
+}
+
+// Client sends requests for a Target.
+type Client interface {
+	// Request returns a fresh copy of the stored request.
+	Request() (*http.Request, error)
+	// Send sends the request, closing its body, and stores the exchange.
+	// The exchange is aborted once the context of the request is done.
+	Send(req *http.Request) (*Response, error)
+}
+
+// ErrBudgetExceeded is returned by Send once a scan sent as many requests as
+// it may.
+var ErrBudgetExceeded = errors.New("request budget of the scan exceeded")
+
+// Response is a stored response to a request sent by a check.
+type Response struct {
+	RequestID  string
+	ResponseID string
+	StatusCode int
+	Header     http.Header
+	// Body is decoded according to Content-Encoding.
+	Body []byte
+	// Elapsed is the time from sending the request to the response headers.
+	Elapsed time.Duration
+}
+
+// Target is a stored request being scanned.
+type Target struct {
+	Data *repo.RequestData
+	// MaxRequests limits the requests sent for the scan, 0 means no limit.
+	MaxRequests int
+
+	ctx      context.Context
+	sent     int
+	client   Client
+	oob      *oob.Server
+	points   []*InsertionPoint
+	baseline *Response
+	// check is the running check, which callbacks are correlated with.
+	check string
+}
+
+// NewTarget returns a target for the request, which is scanned until ctx is
+// done. interactions may be nil if out-of-band interactions are not
+// recorded.
+func NewTarget(ctx context.Context, data *repo.RequestData, client Client, interactions *oob.Server) *Target {
+	return &Target{Data: data, ctx: ctx, client: client, oob: interactions}
+}
+
+// Context is done when the scan is cancelled or out of time.
+func (t *Target) Context() context.Context {
+	return t.ctx
+}
+
+// Request returns a copy of the scanned request to modify.
+func (t *Target) Request() (*http.Request, error) {
+	return t.client.Request()
+}
+
+// InsertionPoints returns the insertion points of the given kinds, or all
+// of them.
+func (t *Target) InsertionPoints(kinds ...PointKind) ([]*InsertionPoint, error) {
+	if t.points == nil {
+		req, err := t.Request()
+		if err != nil {
+			return nil, err
+		}
+		defer req.Body.Close()
+
+		points, err := InsertionPoints(req)
+		if err != nil {
+			return nil, err
+		}
+		t.points = append([]*InsertionPoint{}, points...)
+	}
+
+	return FilterPoints(t.points, kinds...), nil
+}
+
+// Inject returns a copy of the scanned request with value at the point.
+func (t *Target) Inject(point *InsertionPoint, value string) (*http.Request, error) {
+	return t.inject(point, value, false)
+}
+
+// InjectRaw returns a copy of the scanned request with raw inserted
+// verbatim at the point.
+func (t *Target) InjectRaw(point *InsertionPoint, raw string) (*http.Request, error) {
+	return t.inject(point, raw, true)
+}
+
+func (t *Target) inject(point *InsertionPoint, value string, raw bool) (*http.Request, error) {
+	req, err := t.Request()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := point.inject(req, value, raw); err != nil {
+		req.Body.Close()
+		return nil, err
+	}
+	return req, nil
+}
+
+// Baseline sends the scanned request unchanged, once, so that checks can
+// compare their responses with it.
+func (t *Target) Baseline() (*Response, error) {
+	if t.baseline == nil {
+		req, err := t.Request()
+		if err != nil {
+			return nil, err
+		}
+
+		if t.baseline, err = t.Send(req); err != nil {
+			return nil, err
+		}
+	}
+	return t.baseline, nil
+}
+
+// Send sends a modified request and returns the stored response. It fails
+// without sending once the scan is done or out of requests.
+func (t *Target) Send(req *http.Request) (*Response, error) {
+	if t.ctx.Err() != nil {
+		req.Body.Close()
+		return nil, context.Cause(t.ctx)
+	}
+	if t.MaxRequests > 0 && t.sent >= t.MaxRequests {
+		req.Body.Close()
+		return nil, ErrBudgetExceeded
+	}
+
+	t.sent++
+	return t.client.Send(req.WithContext(t.ctx))
+}
+
+// Callback issues an out-of-band payload for blind detection. ok is false
+// if interactions are not recorded.
+func (t *Target) Callback(variant, point string) (payload oob.Payload, ok bool) {
+	if t.oob == nil {
+		return oob.Payload{}, false
+	}
+
+	return t.oob.Issue(oob.Correlation{
+		TargetID:       t.Data.ID.Hex(),
+		Check:          t.check,
+		Variant:        variant,
+		InsertionPoint: point,
+	}), true
+}
+
+// Attach links a callback to the stored request which carried it.
+func (t *Target) Attach(payload oob.Payload, resp *Response) {
+	if t.oob != nil {
+		t.oob.Attach(payload.Token, resp.RequestID)
+	}
+}
+
+// AwaitCallbacks waits for interactions caused by the payloads and returns
+// the records of those which caused any.
+func (t *Target) AwaitCallbacks(payloads []oob.Payload) []oob.Record {
+	if t.oob == nil || len(payloads) == 0 {
+		return nil
+	}
+
+	tokens := make([]string, len(payloads))
+	for i, payload := range payloads {
+		tokens[i] = payload.Token
+	}
+	return t.oob.Await(t.ctx, tokens)
+}
+
+// Report is the result of scanning a request. A failing check is reported
+// in Errors and does not stop the others.
+type Report struct {
+	RequestID string            `json:"request_id"`
+	Checks    []string          `json:"checks"`
+	Findings  []Finding         `json:"findings"`
+	Errors    map[string]string `json:"errors,omitempty"`
+}
+
+// Run runs the checks one after another. Checks which did not start before
+// the target's context was done are reported as errors.
+func Run(t *Target, checks []Check) *Report {
+	report := &Report{
+		RequestID: t.Data.ID.Hex(),
+		Checks:    make([]string, 0, len(checks)),
+		Findings:  []Finding{},
+	}
+
+	for _, check := range checks {
+		report.Checks = append(report.Checks, check.Name())
+		t.check = check.Name()
+
+		var findings []Finding
+		err := t.ctx.Err()
+		if err == nil {
+			findings, err = check.Scan(t)
+		} else {
+			err = fmt.Errorf("not run: %w", context.Cause(t.ctx))
+		}
+		for _, finding := range findings {
+			finding.Check = check.Name()
+			report.Findings = append(report.Findings, finding)
+		}
+
+		if err != nil {
+			if report.Errors == nil {
+				report.Errors = make(map[string]string)
+			}
+			report.Errors[check.Name()] = err.Error()
+		}
+	}
+
+	return report
+}
@@ -0,0 +1,109 @@
+package scanner
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// countingClient answers every request with an empty response.
+type countingClient struct {
+	sent int
+	// cancel is called after the request with this number, if set.
+	cancelAfter int
+	cancel      context.CancelFunc
+}
+
+func (c *countingClient) Request() (*http.Request, error) {
+	return httptest.NewRequest(http.MethodGet, "http://example.com/?q=1", nil), nil
+}
+
+func (c *countingClient) Send(req *http.Request) (*Response, error) {
+	req.Body.Close()
+	if err := req.Context().Err(); err != nil {
+		return nil, err
+	}
+
+	c.sent++
+	if c.sent == c.cancelAfter {
+		c.cancel()
+	}
+	return &Response{StatusCode: http.StatusOK, Header: http.Header{}}, nil
+}
+
+// sendingCheck sends requests until one fails.
+type sendingCheck struct {
+	name string
+}
+
+func (c *sendingCheck) Name() string { return c.name }
+
+func (c *sendingCheck) Scan(t *Target) ([]Finding, error) {
+	for i := 0; i < 10; i++ {
+		req, err := t.Request()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := t.Send(req); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func newTestTarget(ctx context.Context, client Client) *Target {
+	return NewTarget(ctx, &repo.RequestData{ID: primitive.NewObjectID()}, client, nil)
+}
+
+func TestTargetBudget(t *testing.T) {
+	client := &countingClient{}
+	target := newTestTarget(context.Background(), client)
+	target.MaxRequests = 15
+
+	report := Run(target, []Check{&sendingCheck{name: "first"}, &sendingCheck{name: "second"}})
+
+	if client.sent != 15 {
+		t.Errorf("sent %d requests, want 15", client.sent)
+	}
+	if _, failed := report.Errors["first"]; failed {
+		t.Errorf("first check failed: %v", report.Errors)
+	}
+	if !strings.Contains(report.Errors["second"], ErrBudgetExceeded.Error()) {
+		t.Errorf("second check error = %q", report.Errors["second"])
+	}
+}
+
+func TestTargetCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	client := &countingClient{cancelAfter: 3, cancel: cancel}
+	target := newTestTarget(ctx, client)
+
+	report := Run(target, []Check{&sendingCheck{name: "first"}, &sendingCheck{name: "second"}})
+
+	if client.sent != 3 {
+		t.Errorf("sent %d requests, want 3", client.sent)
+	}
+	if !strings.Contains(report.Errors["first"], context.Canceled.Error()) {
+		t.Errorf("first check error = %q", report.Errors["first"])
+	}
+	if !strings.HasPrefix(report.Errors["second"], "not run") {
+		t.Errorf("second check error = %q", report.Errors["second"])
+	}
+	if len(report.Checks) != 2 {
+		t.Errorf("checks = %v", report.Checks)
+	}
+
+	req, _ := client.Request()
+	if _, err := target.Send(req); !errors.Is(err, context.Canceled) {
+		t.Errorf("Send after cancel error = %v", err)
+	}
+}
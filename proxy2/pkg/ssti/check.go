@@ -0,0 +1,124 @@
+package ssti
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strings"
+
+	"http-proxy/pkg/scanner"
+)
+
+type check struct{}
+
+// NewCheck returns the check which injects template expressions into every
+// insertion point.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "ssti"
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	points, err := t.InsertionPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		if point.Filename != "" {
+			continue
+		}
+
+		finding, err := scanPoint(t, point)
+		if err != nil {
+			return findings, err
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// scanPoint sends the probes until one is evaluated, then fingerprints the
+// engine. Expressions are put between tokens, so that only their output
+// between the tokens counts, not numbers elsewhere in the page or the
+// reflected expression.
+func scanPoint(t *scanner.Target, point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	start, end := scanner.Token(), scanner.Token()
+	a, b := 100+rand.IntN(900), 100+rand.IntN(900)
+
+	for _, p := range kProbes {
+		expression, output := p.evaluate(a, b)
+		resp, err := send(t, point, start+expression+end)
+		if err != nil {
+			return nil, err
+		}
+
+		evidence := scanner.Evidence(resp.Body, []byte(start+output+end))
+		if evidence == "" {
+			continue
+		}
+
+		engine, by := p.engine, ""
+		if engine == "" && p.fingerprints != nil {
+			if engine, by, err = identify(t, point, p, start, end); err != nil {
+				return nil, err
+			}
+		}
+
+		detail := fmt.Sprintf("%s evaluated to %s", expression, output)
+		switch {
+		case by != "":
+			detail += ", " + engine + " told by " + by
+		case engine != "":
+			detail += ", which only " + engine + " evaluates"
+		default:
+			engine = Unknown
+			detail += ", engine with " + p.syntax + " syntax not identified"
+		}
+
+		return &scanner.Finding{
+			Name:           "Server-side template injection",
+			Severity:       scanner.SeverityHigh,
+			Confidence:     scanner.ConfidenceFirm,
+			Variant:        engine,
+			InsertionPoint: point.String(),
+			Payload:        start + expression + end,
+			Evidence:       evidence,
+			Detail:         detail,
+			RequestID:      resp.RequestID,
+			ResponseID:     resp.ResponseID,
+		}, nil
+	}
+	return nil, nil
+}
+
+// identify sends the fingerprints of a probe and returns the engine and the
+// output which told it.
+func identify(t *scanner.Target, point *scanner.InsertionPoint, p probe, start, end string) (string, string, error) {
+	for _, f := range p.fingerprints(scanner.Token()) {
+		resp, err := send(t, point, start+f.expression+end)
+		if err != nil {
+			return "", "", err
+		}
+
+		for output, engine := range f.engines {
+			if strings.Contains(string(resp.Body), start+output+end) {
+				return engine, f.expression + " giving " + output, nil
+			}
+		}
+	}
+	return "", "", nil
+}
+
+func send(t *scanner.Target, point *scanner.InsertionPoint, value string) (*scanner.Response, error) {
+	req, err := t.Inject(point, value)
+	if err != nil {
+		return nil, err
+	}
+	return t.Send(req)
+}
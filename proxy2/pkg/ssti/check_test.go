@@ -0,0 +1,139 @@
+package ssti
+
+import (
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"text/template"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+// engine renders the name parameter as a template. It evaluates the
+// expressions matched by the keys of its map.
+type engine map[*regexp.Regexp]func(match []string) string
+
+func (e engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	page := "Hello " + r.URL.Query().Get("name")
+	for expression, evaluate := range e {
+		page = expression.ReplaceAllStringFunc(page, func(s string) string {
+			return evaluate(expression.FindStringSubmatch(s))
+		})
+	}
+	w.Write([]byte(page))
+}
+
+func multiply(match []string) string {
+	a, _ := strconv.Atoi(match[1])
+	b, _ := strconv.Atoi(match[2])
+	return strconv.Itoa(a * b)
+}
+
+func upper(match []string) string {
+	return strings.ToUpper(match[1])
+}
+
+func constant(s string) func([]string) string {
+	return func([]string) string { return s }
+}
+
+// goTemplate renders the name parameter with text/template.
+func goTemplate(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := template.New("page").Parse("Hello " + r.URL.Query().Get("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	tmpl.Execute(w, nil)
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      http.Handler
+		wantVariant string
+	}{
+		{
+			name: "jinja2",
+			server: engine{
+				regexp.MustCompile(`\{\{(\d+)\*(\d+)\}\}`): multiply,
+				regexp.MustCompile(`\{\{7\*'7'\}\}`):       constant("7777777"),
+			},
+			wantVariant: Jinja2,
+		},
+		{
+			name: "twig",
+			server: engine{
+				regexp.MustCompile(`\{\{(\d+)\*(\d+)\}\}`): multiply,
+				regexp.MustCompile(`\{\{7\*'7'\}\}`):       constant("49"),
+			},
+			wantVariant: Twig,
+		},
+		{
+			name: "freemarker",
+			server: engine{
+				regexp.MustCompile(`\$\{(\d+)\*(\d+)\}`):        multiply,
+				regexp.MustCompile(`\$\{"(\w+)"\?upper_case\}`): upper,
+			},
+			wantVariant: Freemarker,
+		},
+		{
+			name: "erb",
+			server: engine{
+				regexp.MustCompile(`<%= (\d+)\*(\d+) %>`):    multiply,
+				regexp.MustCompile(`<%= "(\w+)"\.upcase %>`): upper,
+			},
+			wantVariant: ERB,
+		},
+		{
+			name:        "go template",
+			server:      http.HandlerFunc(goTemplate),
+			wantVariant: GoTemplate,
+		},
+		{
+			name:        "not fingerprinted",
+			server:      engine{regexp.MustCompile(`\{\{(\d+)\*(\d+)\}\}`): multiply},
+			wantVariant: Unknown,
+		},
+		{
+			name:        "other syntax",
+			server:      engine{regexp.MustCompile(`#\{(\d+)\*(\d+)\}`): multiply},
+			wantVariant: Unknown,
+		},
+		{
+			name:   "reflected",
+			server: engine{},
+		},
+		{
+			name: "escaped",
+			server: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("Hello " + html.EscapeString(r.URL.Query().Get("name"))))
+			}),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			target, _ := scannertest.NewTarget(http.MethodGet, server.URL+"/?name=bob", nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:name" {
+				t.Errorf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+// Package ssti finds server-side template injection by injecting
+// expressions in the syntax of template engines and looking for their
+// output. Follow-up expressions which engines evaluate differently tell
+// the engine.
+package ssti
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Engines told apart by fingerprints, used as finding variants.
+const (
+	Jinja2     = "jinja2"
+	Twig       = "twig"
+	Freemarker = "freemarker"
+	GoTemplate = "go_template"
+	ERB        = "erb"
+	Unknown    = "unknown"
+)
+
+// fingerprint is an expression whose output tells the engine.
+type fingerprint struct {
+	expression string
+	// engines maps outputs of the expression to the engines producing them.
+	engines map[string]string
+}
+
+// probe is an expression in the syntax of a family of engines.
+type probe struct {
+	syntax string
+	// evaluate returns an expression computing a and b, and its output.
+	evaluate func(a, b int) (expression, output string)
+	// engine is set if only one engine evaluates the expression, otherwise
+	// fingerprints are sent once it is evaluated.
+	engine       string
+	fingerprints func(token string) []fingerprint
+}
+
+// kProbes are tried in order, the Go template probe comes after the other
+// {{ }} probe, which Go templates cannot evaluate.
+var kProbes = []probe{
+	{
+		syntax:   "{{ }}",
+		evaluate: arithmetic("{{%d*%d}}"),
+		fingerprints: func(string) []fingerprint {
+			// Jinja2 repeats the string, Twig converts it to a number.
+			return []fingerprint{{`{{7*'7'}}`, map[string]string{"7777777": Jinja2, "49": Twig}}}
+		},
+	},
+	{
+		syntax:   "${ }",
+		evaluate: arithmetic("${%d*%d}"),
+		fingerprints: func(token string) []fingerprint {
+			return []fingerprint{{`${"` + token + `"?upper_case}`, map[string]string{strings.ToUpper(token): Freemarker}}}
+		},
+	},
+	{
+		syntax:   "<%= %>",
+		evaluate: arithmetic("<%%= %d*%d %%>"),
+		fingerprints: func(token string) []fingerprint {
+			return []fingerprint{{`<%= "` + token + `".upcase %>`, map[string]string{strings.ToUpper(token): ERB}}}
+		},
+	},
+	{
+		syntax:   "#{ }",
+		evaluate: arithmetic("#{%d*%d}"),
+	},
+	{
+		syntax: "{{ }}",
+		// Go templates have no arithmetic, print joins strings without
+		// spaces.
+		evaluate: func(a, b int) (string, string) {
+			return fmt.Sprintf(`{{print "%d" "%d"}}`, a, b), strconv.Itoa(a) + strconv.Itoa(b)
+		},
+		engine: GoTemplate,
+	},
+}
+
+// arithmetic returns a probe multiplying a and b in the format.
+func arithmetic(format string) func(a, b int) (string, string) {
+	return func(a, b int) (string, string) {
+		return fmt.Sprintf(format, a, b), strconv.Itoa(a * b)
+	}
+}
@@ -0,0 +1,73 @@
+package traversal
+
+import "http-proxy/pkg/scanner"
+
+// kPoints are the parts of a request which commonly name files.
+var kPoints = []scanner.PointKind{scanner.PointPath, scanner.PointQuery, scanner.PointForm}
+
+type check struct{}
+
+// NewCheck returns the check which reads local files through path
+// traversal in path segments, query and form parameters.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "traversal"
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	baseline, err := t.Baseline()
+	if err != nil {
+		return nil, err
+	}
+
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		finding, err := scanPoint(t, point, baseline)
+		if err != nil {
+			return findings, err
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// scanPoint sends the payloads until one shows a file.
+func scanPoint(t *scanner.Target, point *scanner.InsertionPoint, baseline *scanner.Response) (*scanner.Finding, error) {
+	for _, p := range payloads(point.Value) {
+		req, err := t.InjectRaw(point, p.raw)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.Send(req)
+		if err != nil {
+			return nil, err
+		}
+
+		if evidence := p.file.Find(resp.Body, baseline.Body); evidence != "" {
+			return &scanner.Finding{
+				Name:           "Path traversal",
+				Severity:       scanner.SeverityHigh,
+				Confidence:     scanner.ConfidenceFirm,
+				Variant:        p.variant,
+				InsertionPoint: point.String(),
+				Payload:        p.raw,
+				Evidence:       evidence,
+				Detail:         "read " + p.file.Path,
+				RequestID:      resp.RequestID,
+				ResponseID:     resp.ResponseID,
+			}, nil
+		}
+	}
+	return nil, nil
+}
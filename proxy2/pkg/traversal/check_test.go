@@ -0,0 +1,144 @@
+package traversal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"strings"
+	"testing"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+var files = map[string]string{
+	"/etc/passwd":               "root:x:0:0:root:/root:/bin/sh\n",
+	"/var/www/files/report.txt": "quarterly report\n",
+	"/var/www/files/docs/a.txt": "manual\n",
+}
+
+// fileServer shows files from /var/www/files named by the file parameter.
+type fileServer struct {
+	// resolve turns the parameter into a path, or returns false to reject it.
+	resolve func(name string) (string, bool)
+	// banner is shown above every file.
+	banner string
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	name, ok := s.resolve(r.URL.Query().Get("file"))
+	if !ok {
+		http.Error(w, "invalid file name", http.StatusForbidden)
+		return
+	}
+
+	// The path is passed to C, which ends it at a null byte.
+	name, _, _ = strings.Cut(name, "\x00")
+	content, ok := files[path.Clean(name)]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	w.Write([]byte(s.banner + content))
+}
+
+func join(name string) (string, bool) {
+	return path.Join("/var/www/files", name), true
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *fileServer
+		value       string
+		wantVariant string
+	}{
+		{
+			name:        "joined",
+			server:      &fileServer{resolve: join},
+			wantVariant: VariantDotDotSlash,
+		},
+		{
+			name: "filtered once",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				return join(strings.ReplaceAll(name, "../", ""))
+			}},
+			wantVariant: VariantFilterBypass,
+		},
+		{
+			name: "decoded twice",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				if strings.Contains(name, "..") {
+					return "", false
+				}
+				name, err := url.QueryUnescape(name)
+				return path.Join("/var/www/files", name), err == nil
+			}},
+			wantVariant: VariantDoubleEncoded,
+		},
+		{
+			name: "extension appended",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				return join(name + ".txt")
+			}},
+			value:       "report",
+			wantVariant: VariantNullByte,
+		},
+		{
+			name: "absolute",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				if strings.HasPrefix(name, "/") {
+					return name, true
+				}
+				return join(path.Base(name))
+			}},
+			wantVariant: VariantAbsolute,
+		},
+		{
+			name: "prefixed",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				if !strings.HasPrefix(name, "docs/") {
+					return "", false
+				}
+				return join(name)
+			}},
+			value:       "docs/a.txt",
+			wantVariant: VariantPrefixed,
+		},
+		{
+			name: "base name",
+			server: &fileServer{resolve: func(name string) (string, bool) {
+				return join(path.Base(name))
+			}},
+		},
+		{
+			name:   "signature in the baseline",
+			server: &fileServer{resolve: join, banner: "Lines look like root:x:0:0:root:/root:/bin/sh\n"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			value := tt.value
+			if value == "" {
+				value = "report.txt"
+			}
+			target, _ := scannertest.NewTarget(http.MethodGet, server.URL+"/?file="+url.QueryEscape(value), nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:file" {
+				t.Errorf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+		})
+	}
+}
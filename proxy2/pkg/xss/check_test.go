@@ -0,0 +1,136 @@
+package xss
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"text/template"
+
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+const canary = "xsscanary"
+
+func TestFindReflections(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: `<p>{}</p>`, want: []string{"html"}},
+		{body: `<a href="{}">`, want: []string{`url_attribute of <a>, attribute href, quoted with "`}},
+		{body: `<a href="/search?q={}">`, want: []string{`attribute of <a>, attribute href, quoted with "`}},
+		{body: `<input value='{}'>`, want: []string{"attribute of <input>, attribute value, quoted with '"}},
+		{body: `<img src=x alt={}>`, want: []string{"attribute of <img>, attribute alt"}},
+		{body: `<div onclick="go('{}')">`, want: []string{`event_handler of <div>, attribute onclick, quoted with "`}},
+		{body: `<script>var q = "{}";</script>`, want: []string{`script_string of <script>, quoted with "`}},
+		{body: `<script>var q = 'it\'s {}';</script>`, want: []string{"script_string of <script>, quoted with '"}},
+		{body: "<script>var q = {}; // \"</script>", want: []string{"script of <script>"}},
+		{body: "<script>// it's {}\ngo()</script>", want: []string{"script of <script>"}},
+		{body: `<textarea>{}</textarea>`, want: []string{"raw_text of <textarea>"}},
+		{body: `<!-- {} -->`, want: []string{"comment"}},
+		{body: `<x{}>`, want: []string{"tag of <x" + canary + ">"}},
+		{body: `<div {}=1>`, want: []string{"tag of <div>, attribute " + canary}},
+		{body: `<p>{}</p><script>f('{}', "{}")</script>`, want: []string{"html", "script_string of <script>, quoted with '", `script_string of <script>, quoted with "`}},
+		{body: `<p>nothing</p>`},
+	}
+
+	for _, tt := range tests {
+		body := strings.ReplaceAll(tt.body, "{}", canary)
+
+		var got []string
+		for _, r := range findReflections([]byte(body), canary) {
+			got = append(got, r.String())
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("findReflections(%s) = %q, want %q", body, got, tt.want)
+		}
+	}
+}
+
+func TestExecutes(t *testing.T) {
+	const call = "alert(/token/)"
+
+	tests := []struct {
+		body string
+		want bool
+	}{
+		{body: `<img src=x onerror={}>`, want: true},
+		{body: `<div title="x" onmouseover='a="b";{}'>`, want: true},
+		{body: `<script>{}</script>`, want: true},
+		{body: `<a href=" JavaScript:{}">`, want: true},
+		{body: `<p>{}</p>`},
+		{body: `<script>var a = "{}";</script>`},
+		{body: `<a href="/javascript:{}">`},
+		{body: `<img title="onerror={}">`},
+		{body: `<textarea><script>{}</script></textarea>`},
+		{body: `<!-- <script>{}</script> -->`},
+	}
+
+	for _, tt := range tests {
+		body := strings.ReplaceAll(tt.body, "{}", call)
+		if got := executes([]byte(body), call); got != tt.want {
+			t.Errorf("executes(%s) = %v, want %v", body, got, tt.want)
+		}
+	}
+}
+
+// page reflects the q parameter into a template at {}.
+type page struct {
+	template    string
+	escape      func(string) string
+	contentType string
+}
+
+func (p *page) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query().Get("q")
+	if p.escape != nil {
+		q = p.escape(q)
+	}
+	if p.contentType != "" {
+		w.Header().Set("Content-Type", p.contentType)
+	}
+	fmt.Fprint(w, "<html><body>"+strings.ReplaceAll(p.template, "{}", q)+"</body></html>")
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name        string
+		server      *page
+		wantVariant string
+	}{
+		{name: "html", server: &page{template: `<p>Results for {}</p>`}, wantVariant: ContextHTML},
+		{name: "attribute", server: &page{template: `<input name="q" value="{}">`}, wantVariant: ContextAttribute},
+		{name: "url attribute", server: &page{template: `<a href="{}">back</a>`}, wantVariant: ContextURLAttribute},
+		{name: "script string", server: &page{template: `<script>var q = '{}';</script>`}, wantVariant: ContextScriptString},
+		{name: "comment", server: &page{template: `<!-- q={} -->`}, wantVariant: ContextComment},
+		{name: "raw text", server: &page{template: `<textarea>{}</textarea>`}, wantVariant: ContextRawText},
+		{name: "html escaped", server: &page{template: `<p>{}</p><input value="{}">`, escape: html.EscapeString}},
+		{name: "javascript escaped", server: &page{template: `<script>var q = '{}';</script>`, escape: template.JSEscapeString}},
+		{name: "not html", server: &page{template: `<p>{}</p>`, contentType: "application/json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			target, _ := scannertest.NewTarget(http.MethodGet, server.URL+"/?q=x", nil, "", nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantVariant == "" {
+				if len(findings) != 0 {
+					t.Errorf("findings on a safe server: %+v", findings)
+				}
+			} else if len(findings) != 1 || findings[0].Variant != tt.wantVariant || findings[0].InsertionPoint != "query:q" {
+				t.Errorf("findings = %+v, want one %s finding", findings, tt.wantVariant)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package xss
+
+import (
+	"bytes"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Contexts in which input is reflected.
+const (
+	ContextHTML         = "html"
+	ContextAttribute    = "attribute"
+	ContextURLAttribute = "url_attribute"
+	ContextEventHandler = "event_handler"
+	ContextTag          = "tag"
+	ContextScript       = "script"
+	ContextScriptString = "script_string"
+	ContextComment      = "comment"
+	ContextRawText      = "raw_text"
+	ContextUnknown      = "unknown"
+)
+
+// kURLAttributes take URLs, which may use the javascript: scheme.
+var kURLAttributes = []string{"href", "src", "action", "formaction", "data", "xlink:href"}
+
+// reflection is where a canary appears in a response.
+type reflection struct {
+	context string
+	// tag is the enclosing element, attribute the attribute name.
+	tag       string
+	attribute string
+	// quote delimits the attribute value or script string, 0 if unquoted.
+	quote byte
+}
+
+func (r reflection) String() string {
+	s := r.context
+	if r.tag != "" {
+		s += " of <" + r.tag + ">"
+	}
+	if r.attribute != "" {
+		s += ", attribute " + r.attribute
+	}
+	if r.quote != 0 {
+		s += ", quoted with " + string(r.quote)
+	}
+	return s
+}
+
+// findReflections classifies every occurrence of canary in an HTML body.
+func findReflections(body []byte, canary string) []reflection {
+	var reflections []reflection
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	rawTag := ""
+	for {
+		tokenType := z.Next()
+		if tokenType == html.ErrorToken {
+			return reflections
+		}
+
+		raw := string(z.Raw())
+		var tag string
+		var hasAttributes bool
+		if tokenType == html.StartTagToken || tokenType == html.SelfClosingTagToken || tokenType == html.EndTagToken {
+			var name []byte
+			name, hasAttributes = z.TagName()
+			tag = string(name)
+		}
+
+		if strings.Contains(raw, canary) {
+			switch tokenType {
+			case html.TextToken:
+				reflections = append(reflections, textReflections(raw, canary, rawTag)...)
+			case html.CommentToken:
+				reflections = append(reflections, reflection{context: ContextComment})
+			case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+				reflections = append(reflections, tagReflections(z, tag, hasAttributes, raw, canary)...)
+			}
+		}
+
+		switch tokenType {
+		case html.StartTagToken:
+			rawTag = rawTextTag(tag)
+		case html.EndTagToken, html.SelfClosingTagToken:
+			rawTag = ""
+		}
+	}
+}
+
+// rawTextTag returns name if the content of the element is not parsed as
+// HTML.
+func rawTextTag(name string) string {
+	switch name {
+	case "script", "style", "textarea", "title", "xmp", "noscript", "iframe", "noembed", "noframes", "plaintext":
+		return name
+	}
+	return ""
+}
+
+func textReflections(text, canary, rawTag string) []reflection {
+	switch rawTag {
+	case "":
+		return []reflection{{context: ContextHTML}}
+	case "script":
+	default:
+		return []reflection{{context: ContextRawText, tag: rawTag}}
+	}
+
+	var reflections []reflection
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], canary)
+		if idx == -1 {
+			return reflections
+		}
+		idx += offset
+		offset = idx + len(canary)
+
+		if quote := scriptQuote(text[:idx]); quote != 0 {
+			reflections = append(reflections, reflection{context: ContextScriptString, tag: rawTag, quote: quote})
+		} else {
+			reflections = append(reflections, reflection{context: ContextScript, tag: rawTag})
+		}
+	}
+}
+
+// scriptQuote returns the quote of the JavaScript string which is open at
+// the end of script, or 0.
+func scriptQuote(script string) byte {
+	var quote byte
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0 && c == '\\':
+			i++
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\'' || c == '`'):
+			quote = c
+		case quote == 0 && c == '/' && i+1 < len(script) && script[i+1] == '/':
+			if end := strings.IndexByte(script[i:], '\n'); end != -1 {
+				i += end
+			} else {
+				return 0
+			}
+		}
+	}
+	return quote
+}
+
+func tagReflections(z *html.Tokenizer, tag string, hasAttributes bool, raw, canary string) []reflection {
+	if strings.Contains(tag, canary) {
+		return []reflection{{context: ContextTag, tag: tag}}
+	}
+
+	var reflections []reflection
+	for hasAttributes {
+		var key, value []byte
+		key, value, hasAttributes = z.TagAttr()
+		attribute := string(key)
+
+		switch {
+		case strings.Contains(attribute, canary):
+			reflections = append(reflections, reflection{context: ContextTag, tag: tag, attribute: attribute})
+		case strings.Contains(string(value), canary):
+			r := reflection{context: ContextAttribute, tag: tag, attribute: attribute, quote: attributeQuote(raw, attribute)}
+			switch {
+			case strings.HasPrefix(attribute, "on"):
+				r.context = ContextEventHandler
+			case isURLAttribute(attribute) && strings.HasPrefix(string(value), canary):
+				r.context = ContextURLAttribute
+			}
+			reflections = append(reflections, r)
+		}
+	}
+
+	if len(reflections) == 0 {
+		// The canary is in the tag but the tokenizer does not show where,
+		// e.g. after a broken attribute.
+		reflections = append(reflections, reflection{context: ContextUnknown, tag: tag})
+	}
+	return reflections
+}
+
+// attributeQuote returns the quote around the value of an attribute in a
+// raw tag.
+func attributeQuote(raw, attribute string) byte {
+	lower := strings.ToLower(raw)
+	for offset := 0; ; {
+		idx := strings.Index(lower[offset:], attribute)
+		if idx == -1 {
+			return 0
+		}
+		rest := strings.TrimLeft(lower[offset+idx+len(attribute):], " \t\r\n\f")
+		offset += idx + len(attribute)
+
+		if !strings.HasPrefix(rest, "=") {
+			continue
+		}
+		rest = strings.TrimLeft(rest[1:], " \t\r\n\f")
+		if rest != "" && (rest[0] == '"' || rest[0] == '\'') {
+			return rest[0]
+		}
+		return 0
+	}
+}
+
+func isURLAttribute(attribute string) bool {
+	return slices.Contains(kURLAttributes, attribute)
+}
+
+// executes tells whether script runs the call in an HTML body: in an event
+// handler, a javascript: URL or a script, outside of string literals.
+func executes(body []byte, call string) bool {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	inScript := false
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return false
+
+		case html.TextToken:
+			if inScript && runs(string(z.Text()), call) {
+				return true
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttributes := z.TagName()
+			inScript = string(name) == "script"
+			for hasAttributes {
+				var key, value []byte
+				key, value, hasAttributes = z.TagAttr()
+				attribute, script := string(key), string(value)
+
+				if strings.HasPrefix(attribute, "on") && runs(script, call) {
+					return true
+				}
+				script = strings.TrimSpace(script)
+				if isURLAttribute(attribute) && len(script) > 11 && strings.EqualFold(script[:11], "javascript:") && runs(script[11:], call) {
+					return true
+				}
+			}
+
+		case html.EndTagToken:
+			inScript = false
+		}
+	}
+}
+
+// runs tells whether call is in script outside of string literals.
+func runs(script, call string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(script[offset:], call)
+		if idx == -1 {
+			return false
+		}
+		if scriptQuote(script[:offset+idx]) == 0 {
+			return true
+		}
+		offset += idx + len(call)
+	}
+}
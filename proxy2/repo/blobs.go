@@ -0,0 +1,129 @@
+package repo
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const BodiesBucket = "bodies"
+
+type GridFSBlobStore struct {
+	bucket *gridfs.Bucket
+}
+
+func NewGridFSBlobStore(client *mongo.Client) (BlobStore, error) {
+	bucket, err := gridfs.NewBucket(
+		client.Database(DatabaseName),
+		options.GridFSBucket().SetName(BodiesBucket),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GridFSBlobStore{bucket: bucket}, nil
+}
+
+func (s *GridFSBlobStore) Put(r io.Reader) (string, error) {
+	id, err := s.bucket.UploadFromStream("body", r)
+	if err != nil {
+		return "", err
+	}
+	return id.Hex(), nil
+}
+
+func (s *GridFSBlobStore) Open(id string) (io.ReadCloser, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+	return s.bucket.OpenDownloadStream(objectID)
+}
+
+func storeCapture(blobs BlobStore, capture *Capture) (string, error) {
+	body, err := capture.Open()
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	return blobs.Put(body)
+}
+
+// FileBlobStore keeps every blob in a file of its own directory.
+type FileBlobStore struct {
+	dir string
+}
+
+func NewFileBlobStore(dir string) (BlobStore, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &FileBlobStore{dir: dir}, nil
+}
+
+func (s *FileBlobStore) Put(r io.Reader) (string, error) {
+	id := primitive.NewObjectID().Hex()
+
+	file, err := os.OpenFile(filepath.Join(s.dir, id), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := io.Copy(file, r); err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return id, file.Close()
+}
+
+func (s *FileBlobStore) Open(id string) (io.ReadCloser, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(s.dir, id))
+}
+
+type MemoryBlobStore struct {
+	mutex sync.RWMutex
+	blobs map[string][]byte
+}
+
+func NewMemoryBlobStore() BlobStore {
+	return &MemoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *MemoryBlobStore) Put(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	id := primitive.NewObjectID().Hex()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.blobs[id] = data
+	return id, nil
+}
+
+func (s *MemoryBlobStore) Open(id string) (io.ReadCloser, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	data, ok := s.blobs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
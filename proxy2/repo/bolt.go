@@ -0,0 +1,169 @@
+package repo
+
+import (
+	"bytes"
+	"time"
+
+	"go.etcd.io/bbolt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// responsesByRequest is the bucket indexing responses by their request.
+const responsesByRequest = "responses_by_request"
+
+// OpenBolt opens the database file of the embedded backend, creating it if
+// needed.
+func OpenBolt(path string) (*bbolt.DB, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		for _, name := range []string{RequestsCollection, ResponsesCollection} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		if tx.Bucket([]byte(responsesByRequest)) == nil {
+			return createResponseIndex(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// createResponseIndex indexes the responses of databases written before the
+// index existed.
+func createResponseIndex(tx *bbolt.Tx) error {
+	index, err := tx.CreateBucket([]byte(responsesByRequest))
+	if err != nil {
+		return err
+	}
+
+	return tx.Bucket([]byte(ResponsesCollection)).ForEach(func(id, doc []byte) error {
+		requestID, ok := bson.Raw(doc).Lookup("request_id").ObjectIDOK()
+		if !ok {
+			return nil
+		}
+		return index.Put(requestID[:], id)
+	})
+}
+
+func NewBoltRequestSaver(db *bbolt.DB, blobs BlobStore) RequestSaver {
+	return &collectionRequestSaver{
+		requests: &boltCollection{db: db, bucket: []byte(RequestsCollection)},
+		blobs:    blobs,
+	}
+}
+
+func NewBoltResponseSaver(db *bbolt.DB, blobs BlobStore) ResponseSaver {
+	return &collectionResponseSaver{
+		responses: &boltCollection{db: db, bucket: []byte(ResponsesCollection)},
+		byRequest: &boltIndex{db: db, bucket: []byte(responsesByRequest)},
+		blobs:     blobs,
+	}
+}
+
+// boltCollection stores documents in a bucket keyed by the ObjectID bytes,
+// which sort by creation time.
+type boltCollection struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+func (c *boltCollection) put(id primitive.ObjectID, doc []byte) error {
+	return c.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(c.bucket).Put(id[:], doc)
+	})
+}
+
+func (c *boltCollection) get(id primitive.ObjectID) ([]byte, error) {
+	var res []byte
+
+	err := c.db.View(func(tx *bbolt.Tx) error {
+		doc := tx.Bucket(c.bucket).Get(id[:])
+		if doc == nil {
+			return ErrNotFound
+		}
+
+		// Values are only valid during the transaction.
+		res = append([]byte(nil), doc...)
+		return nil
+	})
+
+	return res, err
+}
+
+func (c *boltCollection) scan(r scanRange, fn func(doc []byte) (bool, error)) error {
+	return c.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(c.bucket).Cursor()
+
+		var key, doc []byte
+		next := cursor.Prev
+
+		switch {
+		case r.ascending && !r.after.IsZero():
+			key, doc = cursor.Seek(r.after[:])
+			if bytes.Equal(key, r.after[:]) {
+				key, doc = cursor.Next()
+			}
+			next = cursor.Next
+		case r.ascending:
+			key, doc = cursor.First()
+			next = cursor.Next
+		case !r.before.IsZero():
+			// Seek stops at the first key not before the bound, if any.
+			if key, _ = cursor.Seek(r.before[:]); key == nil {
+				key, doc = cursor.Last()
+			} else {
+				key, doc = cursor.Prev()
+			}
+		default:
+			key, doc = cursor.Last()
+		}
+
+		for ; key != nil && r.contains(key); key, doc = next() {
+			more, err := fn(append([]byte(nil), doc...))
+			if err != nil || !more {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// boltIndex keeps an index in a bucket mapping key to id bytes.
+type boltIndex struct {
+	db     *bbolt.DB
+	bucket []byte
+}
+
+func (i *boltIndex) set(key, id primitive.ObjectID) error {
+	return i.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(i.bucket).Put(key[:], id[:])
+	})
+}
+
+func (i *boltIndex) lookup(key primitive.ObjectID) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+
+	err := i.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(i.bucket).Get(key[:])
+		if len(value) != len(id) {
+			return ErrNotFound
+		}
+
+		copy(id[:], value)
+		return nil
+	})
+
+	return id, err
+}
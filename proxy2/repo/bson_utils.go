@@ -2,6 +2,7 @@ package repo
 
 import (
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 func convertToBSON(values map[string][]string) bson.M {
@@ -27,6 +28,8 @@ func convertFromBSON(data bson.M) map[string][]string {
 			result[key] = []string{v}
 		case []interface{}:
 			result[key] = convertToStringSlice(v)
+		case primitive.A:
+			result[key] = convertToStringSlice(v)
 		}
 	}
 
@@ -0,0 +1,177 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+)
+
+// DefaultBodyLimit is the number of body bytes stored inline in a record.
+// Larger bodies are kept in a BlobStore.
+const DefaultBodyLimit = 1 << 20
+
+// Capture records a body while it is streamed to its destination. The first
+// limit bytes are kept in memory; once the body grows past the limit, the
+// whole body is spilled into a temporary file.
+type Capture struct {
+	src   io.ReadCloser
+	limit int64
+	buf   bytes.Buffer
+	spill *os.File
+	size  int64
+	done  bool
+
+	truncated bool
+}
+
+func NewCapture(src io.ReadCloser, limit int64) *Capture {
+	if src == nil {
+		src = http.NoBody
+	}
+	return &Capture{
+		src:   src,
+		limit: limit,
+	}
+}
+
+func (c *Capture) Read(p []byte) (int, error) {
+	n, err := c.src.Read(p)
+	if n > 0 {
+		if werr := c.record(p[:n]); werr != nil {
+			return n, werr
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		c.done = true
+	}
+	return n, err
+}
+
+func (c *Capture) Close() error {
+	return c.src.Close()
+}
+
+func (c *Capture) record(p []byte) error {
+	c.size += int64(len(p))
+
+	if c.spill == nil && int64(c.buf.Len()+len(p)) <= c.limit {
+		c.buf.Write(p)
+		return nil
+	}
+
+	if c.spill == nil {
+		spill, err := os.CreateTemp("", "http-proxy-body-*")
+		if err != nil {
+			return err
+		}
+		c.spill = spill
+		c.truncated = true
+
+		if _, err := c.spill.Write(c.buf.Bytes()); err != nil {
+			return err
+		}
+		if rest := c.limit - int64(c.buf.Len()); rest > 0 {
+			c.buf.Write(p[:rest])
+		}
+	}
+
+	_, err := c.spill.Write(p)
+	return err
+}
+
+// Drain reads the rest of the body, so that the capture is complete.
+func (c *Capture) Drain() error {
+	if c.done {
+		return nil
+	}
+	_, err := io.Copy(io.Discard, c)
+	return err
+}
+
+// Bytes returns the inline part of the body, at most limit bytes.
+func (c *Capture) Bytes() []byte {
+	return c.buf.Bytes()
+}
+
+// Size returns the number of body bytes read so far.
+func (c *Capture) Size() int64 {
+	return c.size
+}
+
+// Truncated reports whether the body did not fit into the inline limit.
+func (c *Capture) Truncated() bool {
+	return c.truncated
+}
+
+// Open returns a reader over the whole captured body. It must not be called
+// after Release.
+func (c *Capture) Open() (io.ReadCloser, error) {
+	if !c.truncated {
+		return io.NopCloser(bytes.NewReader(c.buf.Bytes())), nil
+	}
+	if c.spill == nil {
+		return nil, errors.New("captured body was released")
+	}
+	return os.Open(c.spill.Name())
+}
+
+// Replay returns a reader over the whole captured body, which releases the
+// capture when closed.
+func (c *Capture) Replay() (io.ReadCloser, error) {
+	replay, err := c.Open()
+	if err != nil {
+		return nil, err
+	}
+	return &releasingReader{ReadCloser: replay, capture: c}, nil
+}
+
+// Release removes the spill file, if any.
+func (c *Capture) Release() error {
+	if c.spill == nil {
+		return nil
+	}
+
+	c.spill.Close()
+	err := os.Remove(c.spill.Name())
+	c.spill = nil
+	return err
+}
+
+// captureBody returns the capture that recorded *body, reading whatever the
+// caller has not consumed yet. A body that was not captured by the caller is
+// captured here and replaced with a reader over the same bytes, which
+// releases the capture when closed.
+func captureBody(body *io.ReadCloser, limit int64) (*Capture, error) {
+	if capture, ok := (*body).(*Capture); ok {
+		return capture, capture.Drain()
+	}
+
+	capture := NewCapture(*body, limit)
+	if err := capture.Drain(); err != nil {
+		capture.Release()
+		return nil, err
+	}
+	capture.Close()
+
+	replay, err := capture.Replay()
+	if err != nil {
+		capture.Release()
+		return nil, err
+	}
+
+	*body = replay
+	return capture, nil
+}
+
+type releasingReader struct {
+	io.ReadCloser
+	capture *Capture
+}
+
+func (r *releasingReader) Close() error {
+	err := r.ReadCloser.Close()
+	r.capture.Release()
+	return err
+}
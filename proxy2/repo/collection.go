@@ -0,0 +1,220 @@
+package repo
+
+import (
+	"io"
+	"net/http"
+	"slices"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// collection is an ordered store of BSON documents keyed by their ObjectID,
+// the storage primitive of the embedded and in-memory backends.
+type collection interface {
+	put(id primitive.ObjectID, doc []byte) error
+	// get returns ErrNotFound for unknown ids.
+	get(id primitive.ObjectID) ([]byte, error)
+	// scan visits the documents of the range from the newest to the oldest,
+	// or the other way around for ascending ranges, until fn returns false or
+	// an error.
+	scan(r scanRange, fn func(doc []byte) (bool, error)) error
+}
+
+// index maps ids of one collection to ids of another, e.g. requests to their
+// responses, so that joins do not scan the collection.
+type index interface {
+	set(key, id primitive.ObjectID) error
+	// lookup returns ErrNotFound for unknown keys.
+	lookup(key primitive.ObjectID) (primitive.ObjectID, error)
+}
+
+type collectionRequestSaver struct {
+	requests collection
+	blobs    BlobStore
+}
+
+func (s *collectionRequestSaver) Save(req *http.Request, opts ...SaveOption) (string, error) {
+	data, err := newRequestData(req, s.blobs, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err := putDocument(s.requests, data.ID, data); err != nil {
+		return "", err
+	}
+
+	return data.ID.Hex(), nil
+}
+
+func (s *collectionRequestSaver) Get(id string) (*RequestData, error) {
+	value := &RequestData{}
+	if err := getDocument(s.requests, id, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *collectionRequestSaver) GetEncoded(id string) (*http.Request, error) {
+	value, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return encodeRequest(value, s.blobs)
+}
+
+func (s *collectionRequestSaver) List(filter Filter, page Page) (*RequestPage, error) {
+	r, err := page.scanRange()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &RequestPage{Items: make([]*RequestData, 0, page.Limit/2)}
+	more := false
+
+	err = s.requests.scan(r, func(doc []byte) (bool, error) {
+		value := &RequestData{}
+		if err := bson.Unmarshal(doc, value); err != nil {
+			return false, err
+		}
+
+		if !filter.matchRequest(value) {
+			return true, nil
+		}
+		if int64(len(res.Items)) == page.Limit {
+			more = true
+			return false, nil
+		}
+
+		res.Items = append(res.Items, value)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ascending {
+		slices.Reverse(res.Items)
+	}
+	if len(res.Items) != 0 {
+		res.Next = r.nextCursor(res.Items[len(res.Items)-1].ID, more)
+	}
+
+	return res, nil
+}
+
+type collectionResponseSaver struct {
+	responses collection
+	byRequest index
+	blobs     BlobStore
+}
+
+func (s *collectionResponseSaver) Save(requestID string, resp *http.Response, opts ...SaveOption) (string, error) {
+	data, err := newResponseData(requestID, resp, s.blobs, opts)
+	if err != nil {
+		return "", err
+	}
+
+	if err := putDocument(s.responses, data.ID, data); err != nil {
+		return "", err
+	}
+	if err := s.byRequest.set(data.RequestID, data.ID); err != nil {
+		return "", err
+	}
+
+	return data.ID.Hex(), nil
+}
+
+func (s *collectionResponseSaver) Get(id string) (*ResponseData, error) {
+	value := &ResponseData{}
+	if err := getDocument(s.responses, id, value); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+func (s *collectionResponseSaver) GetByRequest(requestID string) (*ResponseData, error) {
+	objectID, err := primitive.ObjectIDFromHex(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := s.byRequest.lookup(objectID)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.Get(id.Hex())
+}
+
+func (s *collectionResponseSaver) OpenBody(id string) (io.ReadCloser, error) {
+	resp, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return openResponseBody(resp, s.blobs)
+}
+
+func (s *collectionResponseSaver) List(filter Filter, page Page) (*ResponsePage, error) {
+	r, err := page.scanRange()
+	if err != nil {
+		return nil, err
+	}
+
+	res := &ResponsePage{Items: make([]*ResponseData, 0, page.Limit/2)}
+	more := false
+
+	err = s.responses.scan(r, func(doc []byte) (bool, error) {
+		value := &ResponseData{}
+		if err := bson.Unmarshal(doc, value); err != nil {
+			return false, err
+		}
+
+		if !filter.matchResponse(value) {
+			return true, nil
+		}
+		if int64(len(res.Items)) == page.Limit {
+			more = true
+			return false, nil
+		}
+
+		res.Items = append(res.Items, value)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if r.ascending {
+		slices.Reverse(res.Items)
+	}
+	if len(res.Items) != 0 {
+		res.Next = r.nextCursor(res.Items[len(res.Items)-1].ID, more)
+	}
+
+	return res, nil
+}
+
+func putDocument(c collection, id primitive.ObjectID, value interface{}) error {
+	doc, err := bson.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return c.put(id, doc)
+}
+
+func getDocument(c collection, id string, value interface{}) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	doc, err := c.get(objectID)
+	if err != nil {
+		return err
+	}
+
+	return bson.Unmarshal(doc, value)
+}
@@ -0,0 +1,274 @@
+package repo
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"go.etcd.io/bbolt"
+)
+
+type backend struct {
+	requests  RequestSaver
+	responses ResponseSaver
+}
+
+// forEachBackend runs the test against the in-memory and the bolt backend.
+func forEachBackend(t *testing.T, test func(t *testing.T, b backend)) {
+	t.Run("memory", func(t *testing.T) {
+		blobs := NewMemoryBlobStore()
+		test(t, backend{NewMemoryRequestSaver(blobs), NewMemoryResponseSaver(blobs)})
+	})
+
+	t.Run("bolt", func(t *testing.T) {
+		db := openTestBolt(t, filepath.Join(t.TempDir(), "proxy.db"))
+		blobs := NewMemoryBlobStore()
+		test(t, backend{NewBoltRequestSaver(db, blobs), NewBoltResponseSaver(db, blobs)})
+	})
+}
+
+func openTestBolt(t *testing.T, path string) *bbolt.DB {
+	t.Helper()
+	db, err := OpenBolt(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// saveExchange stores a request and its response, returning their ids.
+func saveExchange(t *testing.T, b backend, method, target string, code int, body string) (string, string) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, target, nil)
+	requestID, err := b.requests.Save(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := &http.Response{
+		StatusCode: code,
+		Status:     http.StatusText(code),
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       http.NoBody,
+	}
+	if body != "" {
+		resp.Body = io.NopCloser(strings.NewReader(body))
+	}
+	responseID, err := b.responses.Save(requestID, resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return requestID, responseID
+}
+
+func TestCollectionSaveAndGet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		requestID, responseID := saveExchange(t, b, http.MethodPost, "http://example.com/login?next=/", 302, "moved")
+
+		req, err := b.requests.Get(requestID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != http.MethodPost || req.Host != "example.com" || req.Path != "/login" {
+			t.Errorf("request = %s %s%s", req.Method, req.Host, req.Path)
+		}
+
+		resp, err := b.responses.Get(responseID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.Code != 302 || string(resp.Body) != "moved" || resp.RequestID.Hex() != requestID {
+			t.Errorf("response = %d %q for %s", resp.Code, resp.Body, resp.RequestID.Hex())
+		}
+
+		if _, err := b.requests.Get(responseID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(unknown) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCollectionGetByRequest(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		ids := make(map[string]string)
+		for _, path := range []string{"/a", "/b", "/c"} {
+			requestID, responseID := saveExchange(t, b, http.MethodGet, "http://example.com"+path, 200, path)
+			ids[requestID] = responseID
+		}
+
+		for requestID, responseID := range ids {
+			resp, err := b.responses.GetByRequest(requestID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.ID.Hex() != responseID {
+				t.Errorf("GetByRequest(%s) = %s, want %s", requestID, resp.ID.Hex(), responseID)
+			}
+		}
+
+		// Requests without a response are not found.
+		requestID, err := b.requests.Save(httptest.NewRequest(http.MethodGet, "http://example.com/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.responses.GetByRequest(requestID); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByRequest(no response) error = %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCollectionList(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		var requestIDs []string
+		for i, path := range []string{"/one", "/two", "/three", "/four", "/five"} {
+			method := http.MethodGet
+			if i%2 == 1 {
+				method = http.MethodPost
+			}
+			requestID, _ := saveExchange(t, b, method, "http://example.com"+path, 200+i, "body"+path)
+			requestIDs = append(requestIDs, requestID)
+		}
+
+		// Cookie headers are stored as parsed cookies.
+		req := httptest.NewRequest(http.MethodGet, "http://example.com/six", nil)
+		req.Header.Set("Cookie", "session=abc")
+		requestID, err := b.requests.Save(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		requestIDs = append(requestIDs, requestID)
+
+		tests := []struct {
+			name   string
+			filter Filter
+			want   []int
+		}{
+			{name: "all", want: []int{5, 4, 3, 2, 1, 0}},
+			{name: "method", filter: Filter{Method: "post"}, want: []int{3, 1}},
+			{name: "path", filter: Filter{Path: "/t"}, want: []int{2, 1}},
+			{name: "cookie header", filter: Filter{Headers: []string{"cookie"}}, want: []int{5}},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				page, err := b.requests.List(tt.filter, Page{Limit: 10})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := requestIndexes(page.Items, requestIDs); !slices.Equal(got, tt.want) {
+					t.Errorf("List = %v, want %v", got, tt.want)
+				}
+			})
+		}
+
+		resps, err := b.responses.List(Filter{Code: 203}, Page{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resps.Items) != 1 || resps.Items[0].RequestID.Hex() != requestIDs[3] {
+			t.Errorf("List(code) = %d items", len(resps.Items))
+		}
+
+		resps, err = b.responses.List(Filter{Body: "FIVE"}, Page{Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(resps.Items) != 1 || resps.Items[0].RequestID.Hex() != requestIDs[4] {
+			t.Errorf("List(body) = %d items", len(resps.Items))
+		}
+	})
+}
+
+func TestCollectionPaging(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, b backend) {
+		var requestIDs []string
+		for i := 0; i < 5; i++ {
+			requestID, _ := saveExchange(t, b, http.MethodGet, "http://example.com/", 200, "")
+			requestIDs = append(requestIDs, requestID)
+		}
+
+		first, err := b.requests.List(Filter{}, Page{Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := requestIndexes(first.Items, requestIDs); !slices.Equal(got, []int{4, 3}) || first.Next == "" {
+			t.Fatalf("first page = %v, next %q", got, first.Next)
+		}
+
+		second, err := b.requests.List(Filter{}, Page{Before: first.Next, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := requestIndexes(second.Items, requestIDs); !slices.Equal(got, []int{2, 1}) {
+			t.Errorf("second page = %v", got)
+		}
+
+		last, err := b.requests.List(Filter{}, Page{Before: second.Next, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := requestIndexes(last.Items, requestIDs); !slices.Equal(got, []int{0}) || last.Next != "" {
+			t.Errorf("last page = %v, next %q", got, last.Next)
+		}
+
+		// After returns the records closest to the cursor, newest first.
+		newer, err := b.requests.List(Filter{}, Page{After: second.Next, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := requestIndexes(newer.Items, requestIDs); !slices.Equal(got, []int{3, 2}) {
+			t.Errorf("page after = %v", got)
+		}
+
+		if _, err := b.requests.List(Filter{}, Page{Before: "invalid", Limit: 2}); err == nil {
+			t.Error("no error for an invalid cursor")
+		}
+	})
+}
+
+func TestBoltResponseIndexRebuilt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "proxy.db")
+	blobs := NewMemoryBlobStore()
+
+	db := openTestBolt(t, path)
+	b := backend{NewBoltRequestSaver(db, blobs), NewBoltResponseSaver(db, blobs)}
+	requestID, responseID := saveExchange(t, b, http.MethodGet, "http://example.com/", 200, "")
+
+	// Databases written before the index existed are indexed when opened.
+	err := db.Update(func(tx *bbolt.Tx) error {
+		return tx.DeleteBucket([]byte(responsesByRequest))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	db = openTestBolt(t, path)
+	resp, err := NewBoltResponseSaver(db, blobs).GetByRequest(requestID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.ID.Hex() != responseID {
+		t.Errorf("GetByRequest = %s, want %s", resp.ID.Hex(), responseID)
+	}
+}
+
+// requestIndexes maps the listed requests to their position in ids.
+func requestIndexes(items []*RequestData, ids []string) []int {
+	var res []int
+	for _, item := range items {
+		for i, id := range ids {
+			if item.ID.Hex() == id {
+				res = append(res, i)
+			}
+		}
+	}
+	return res
+}
@@ -0,0 +1,226 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Filter selects stored records, zero fields match everything. Host, Method,
+// Path, PathRegex and Params apply to requests, Code applies to responses,
+// the remaining fields apply to both.
+type Filter struct {
+	// Host matches with or without a port, ignoring case.
+	Host   string
+	Method string
+	// Path is a prefix of the request path.
+	Path      string
+	PathRegex *regexp.Regexp
+	Code      int
+	// ContentType is a case-insensitive part of the Content-Type header.
+	ContentType string
+	Since       time.Time
+	Until       time.Time
+	// Headers and Params must all be present. Params are looked up in the
+	// query and the form parameters, Cookie in the parsed request cookies.
+	Headers []string
+	Params  []string
+	// Body is a case-insensitive part of the body stored inline, which is
+	// cut at the body limit (DefaultBodyLimit unless configured). The rest
+	// of a truncated body is kept in the blob store and is not searched.
+	Body string
+	// Source is one of the Source constants, records saved before sources
+	// were introduced count as SourceProxy.
+	Source string
+	Parent primitive.ObjectID
+}
+
+// Validate rejects header and param names that Mongo would read as a path
+// or an operator.
+func (f *Filter) Validate() error {
+	for _, names := range [][]string{f.Headers, f.Params} {
+		for _, name := range names {
+			if name == "" || strings.ContainsAny(name, ".$") {
+				return fmt.Errorf("invalid name %q: must not be empty or contain . or $", name)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Filter) requestQuery() bson.M {
+	query := f.commonQuery()
+
+	if f.Host != "" {
+		query["host"] = primitive.Regex{Pattern: hostPattern(f.Host), Options: "i"}
+	}
+	if f.Method != "" {
+		query["method"] = strings.ToUpper(f.Method)
+	}
+
+	var and bson.A
+	if f.Path != "" {
+		and = append(and, bson.M{"path": primitive.Regex{Pattern: "^" + regexp.QuoteMeta(f.Path)}})
+	}
+	if f.PathRegex != nil {
+		and = append(and, bson.M{"path": primitive.Regex{Pattern: f.PathRegex.String()}})
+	}
+	for _, name := range f.Params {
+		and = append(and, bson.M{"$or": bson.A{
+			bson.M{"get_params." + name: bson.M{"$exists": true}},
+			bson.M{"post_params." + name: bson.M{"$exists": true}},
+		}})
+	}
+	if len(and) != 0 {
+		query["$and"] = and
+	}
+
+	return query
+}
+
+func (f *Filter) responseQuery() bson.M {
+	query := f.commonQuery()
+
+	if f.Code != 0 {
+		query["code"] = f.Code
+	}
+
+	return query
+}
+
+// commonQuery covers everything but the body, which is stored as binary and
+// is matched by matchBody after decoding.
+func (f *Filter) commonQuery() bson.M {
+	query := bson.M{}
+
+	if f.ContentType != "" {
+		query["headers.Content-Type"] = primitive.Regex{Pattern: regexp.QuoteMeta(f.ContentType), Options: "i"}
+	}
+
+	timestamp := bson.M{}
+	if !f.Since.IsZero() {
+		timestamp["$gte"] = primitive.NewDateTimeFromTime(f.Since)
+	}
+	if !f.Until.IsZero() {
+		timestamp["$lt"] = primitive.NewDateTimeFromTime(f.Until)
+	}
+	if len(timestamp) != 0 {
+		query["timestamp"] = timestamp
+	}
+
+	for _, name := range f.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if name == "Cookie" {
+			query["$or"] = bson.A{
+				bson.M{"headers.Cookie": bson.M{"$exists": true}},
+				bson.M{"cookies": bson.M{"$nin": bson.A{nil, bson.M{}}}},
+			}
+			continue
+		}
+		query["headers."+name] = bson.M{"$exists": true}
+	}
+
+	if f.Source == SourceProxy {
+		query["source"] = bson.M{"$in": bson.A{SourceProxy, nil}}
+	} else if f.Source != "" {
+		query["source"] = f.Source
+	}
+	if !f.Parent.IsZero() {
+		query["parent_id"] = f.Parent
+	}
+
+	return query
+}
+
+func (f *Filter) matchRequest(r *RequestData) bool {
+	if f.Host != "" && !matchHost(f.Host, r.Host) {
+		return false
+	}
+	if f.Method != "" && !strings.EqualFold(f.Method, r.Method) {
+		return false
+	}
+	if !strings.HasPrefix(r.Path, f.Path) {
+		return false
+	}
+	if f.PathRegex != nil && !f.PathRegex.MatchString(r.Path) {
+		return false
+	}
+	for _, name := range f.Params {
+		_, inQuery := r.GetParams[name]
+		_, inForm := r.PostParams[name]
+		if !inQuery && !inForm {
+			return false
+		}
+	}
+
+	return f.matchLineage(r.Source, r.ParentID) && f.matchCommon(r.Headers, r.Cookies, r.Timestamp) && f.matchBody(r.Body)
+}
+
+func (f *Filter) matchResponse(r *ResponseData) bool {
+	if f.Code != 0 && f.Code != r.Code {
+		return false
+	}
+
+	return f.matchLineage(r.Source, r.ParentID) && f.matchCommon(r.Headers, nil, r.Timestamp) && f.matchBody(r.Body)
+}
+
+func (f *Filter) matchLineage(source string, parent *primitive.ObjectID) bool {
+	if source == "" {
+		source = SourceProxy
+	}
+	if f.Source != "" && f.Source != source {
+		return false
+	}
+	return f.Parent.IsZero() || parent != nil && *parent == f.Parent
+}
+
+// matchCommon checks the filters of both kinds of records. Requests are
+// stored with their Cookie header parsed into cookies.
+func (f *Filter) matchCommon(headers bson.M, cookies map[string]string, timestamp primitive.DateTime) bool {
+	if f.ContentType != "" {
+		contentType := strings.ToLower(headerValue(headers, "Content-Type"))
+		if !strings.Contains(contentType, strings.ToLower(f.ContentType)) {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && timestamp.Time().Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !timestamp.Time().Before(f.Until) {
+		return false
+	}
+	for _, name := range f.Headers {
+		name = http.CanonicalHeaderKey(name)
+		if _, ok := headers[name]; ok || name == "Cookie" && len(cookies) != 0 {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func (f *Filter) matchBody(body []byte) bool {
+	if f.Body == "" {
+		return true
+	}
+	return bytes.Contains(bytes.ToLower(body), bytes.ToLower([]byte(f.Body)))
+}
+
+func hostPattern(host string) string {
+	return "^" + regexp.QuoteMeta(host) + "(:[0-9]+)?$"
+}
+
+func matchHost(filter, host string) bool {
+	if strings.EqualFold(filter, host) {
+		return true
+	}
+	hostname, _, err := net.SplitHostPort(host)
+	return err == nil && strings.EqualFold(filter, hostname)
+}
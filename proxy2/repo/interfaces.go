@@ -1,17 +1,29 @@
 package repo
 
-import "net/http"
+import (
+	"io"
+	"net/http"
+)
 
 type RequestSaver interface {
-	Save(*http.Request) (string, error)
+	Save(*http.Request, ...SaveOption) (string, error)
 	Get(string) (*RequestData, error)
 	GetEncoded(string) (*http.Request, error)
-	List(int64) ([]*RequestData, error)
+	List(Filter, Page) (*RequestPage, error)
 }
 
 type ResponseSaver interface {
-	Save(string, *http.Response) (string, error)
+	Save(string, *http.Response, ...SaveOption) (string, error)
 	Get(string) (*ResponseData, error)
 	GetByRequest(string) (*ResponseData, error)
-	List(int64) ([]*ResponseData, error)
+	// OpenBody returns the complete body: the bytes as received if the body
+	// did not fit into the record, the stored body otherwise.
+	OpenBody(string) (io.ReadCloser, error)
+	List(Filter, Page) (*ResponsePage, error)
+}
+
+// BlobStore keeps bodies that are too large to be stored inline.
+type BlobStore interface {
+	Put(io.Reader) (string, error)
+	Open(string) (io.ReadCloser, error)
 }
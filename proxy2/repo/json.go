@@ -0,0 +1,100 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"strings"
+	"unicode/utf8"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	BodyEncodingText   = "text"
+	BodyEncodingBase64 = "base64"
+)
+
+// MarshalJSON represents the body as text when it is readable and as base64
+// otherwise, see EncodeBody.
+func (r *RequestData) MarshalJSON() ([]byte, error) {
+	type requestData RequestData
+
+	body, encoding := EncodeBody(r.Body, headerValue(r.Headers, "Content-Type"))
+	return json.Marshal(struct {
+		*requestData
+		Body         string
+		BodyEncoding string `json:",omitempty"`
+	}{(*requestData)(r), body, encoding})
+}
+
+func (r *ResponseData) MarshalJSON() ([]byte, error) {
+	type responseData ResponseData
+
+	body, encoding := EncodeBody(r.Body, headerValue(r.Headers, "Content-Type"))
+	return json.Marshal(struct {
+		*responseData
+		Body         string
+		BodyEncoding string `json:",omitempty"`
+	}{(*responseData)(r), body, encoding})
+}
+
+// EncodeBody returns the body as a string together with its encoding. Bodies
+// are sent as text if they are valid UTF-8 and the content type is not a
+// binary one.
+func EncodeBody(body []byte, contentType string) (string, string) {
+	if len(body) == 0 {
+		return "", ""
+	}
+	if utf8.Valid(body) && !isBinaryContentType(contentType) {
+		return string(body), BodyEncodingText
+	}
+	return base64.StdEncoding.EncodeToString(body), BodyEncodingBase64
+}
+
+func isBinaryContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	switch {
+	case mediaType == "image/svg+xml":
+		return false
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"),
+		strings.HasPrefix(mediaType, "font/"),
+		strings.Contains(mediaType, "protobuf"),
+		strings.Contains(mediaType, "grpc"),
+		strings.Contains(mediaType, "msgpack"):
+		return true
+	}
+
+	switch mediaType {
+	case "application/octet-stream", "application/pdf", "application/zip",
+		"application/gzip", "application/x-gzip", "application/wasm":
+		return true
+	}
+
+	return false
+}
+
+// headerValue returns the first value of a header stored with convertToBSON.
+func headerValue(headers bson.M, name string) string {
+	switch v := headers[name].(type) {
+	case string:
+		return v
+	case primitive.A:
+		if len(v) != 0 {
+			s, _ := v[0].(string)
+			return s
+		}
+	case []string:
+		if len(v) != 0 {
+			return v[0]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,52 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestMarshalJSONBody(t *testing.T) {
+	binary := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+
+	tests := []struct {
+		name         string
+		body         []byte
+		contentType  string
+		wantBody     string
+		wantEncoding string
+	}{
+		{name: "utf-8", body: []byte("héllo ✓"), contentType: "text/plain; charset=utf-8", wantBody: "héllo ✓", wantEncoding: BodyEncodingText},
+		{name: "svg", body: []byte("<svg/>"), contentType: "image/svg+xml", wantBody: "<svg/>", wantEncoding: BodyEncodingText},
+		{name: "binary", body: binary, wantBody: base64.StdEncoding.EncodeToString(binary), wantEncoding: BodyEncodingBase64},
+		{name: "binary content type", body: []byte("GIF89a"), contentType: "image/gif", wantBody: "R0lGODlh", wantEncoding: BodyEncodingBase64},
+		{name: "empty", contentType: "text/plain"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			headers := convertToBSON(http.Header{"Content-Type": {tt.contentType}})
+
+			records := map[string]json.Marshaler{
+				"request":  &RequestData{Headers: headers, Body: tt.body},
+				"response": &ResponseData{Headers: headers, Body: tt.body},
+			}
+			for kind, record := range records {
+				data, err := json.Marshal(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var got map[string]interface{}
+				if err := json.Unmarshal(data, &got); err != nil {
+					t.Fatal(err)
+				}
+				encoding, hasEncoding := got["BodyEncoding"]
+				if got["Body"] != tt.wantBody || hasEncoding != (tt.wantEncoding != "") || hasEncoding && encoding != tt.wantEncoding {
+					t.Errorf("%s body = %q encoded as %v, want %q as %q", kind, got["Body"], encoding, tt.wantBody, tt.wantEncoding)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,136 @@
+package repo
+
+import (
+	"bytes"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryCollection keeps documents in memory, e.g. for tests or short
+// sessions that do not need to be persisted.
+type memoryCollection struct {
+	mutex sync.RWMutex
+	ids   []primitive.ObjectID
+	docs  map[primitive.ObjectID][]byte
+}
+
+func newMemoryCollection() *memoryCollection {
+	return &memoryCollection{
+		docs: make(map[primitive.ObjectID][]byte),
+	}
+}
+
+func NewMemoryRequestSaver(blobs BlobStore) RequestSaver {
+	return &collectionRequestSaver{
+		requests: newMemoryCollection(),
+		blobs:    blobs,
+	}
+}
+
+func NewMemoryResponseSaver(blobs BlobStore) ResponseSaver {
+	return &collectionResponseSaver{
+		responses: newMemoryCollection(),
+		byRequest: &memoryIndex{ids: make(map[primitive.ObjectID]primitive.ObjectID)},
+		blobs:     blobs,
+	}
+}
+
+func (c *memoryCollection) put(id primitive.ObjectID, doc []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, exists := c.docs[id]; !exists {
+		idx := sort.Search(len(c.ids), func(i int) bool {
+			return bytes.Compare(c.ids[i][:], id[:]) > 0
+		})
+
+		// ObjectIDs grow over time, so this is almost always an append. The
+		// rare insert copies the slice, as scans may hold the old one.
+		if idx == len(c.ids) {
+			c.ids = append(c.ids, id)
+		} else {
+			ids := make([]primitive.ObjectID, 0, len(c.ids)+1)
+			ids = append(ids, c.ids[:idx]...)
+			ids = append(ids, id)
+			c.ids = append(ids, c.ids[idx:]...)
+		}
+	}
+
+	c.docs[id] = doc
+	return nil
+}
+
+func (c *memoryCollection) get(id primitive.ObjectID) ([]byte, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	doc, ok := c.docs[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return doc, nil
+}
+
+func (c *memoryCollection) scan(r scanRange, fn func(doc []byte) (bool, error)) error {
+	c.mutex.RLock()
+	ids := c.ids
+	c.mutex.RUnlock()
+
+	// The range covers ids[lo:hi].
+	lo, hi := 0, len(ids)
+	if !r.after.IsZero() {
+		lo = sort.Search(len(ids), func(i int) bool {
+			return bytes.Compare(ids[i][:], r.after[:]) > 0
+		})
+	}
+	if !r.before.IsZero() {
+		hi = sort.Search(len(ids), func(i int) bool {
+			return bytes.Compare(ids[i][:], r.before[:]) >= 0
+		})
+	}
+
+	for n := 0; n < hi-lo; n++ {
+		i := hi - 1 - n
+		if r.ascending {
+			i = lo + n
+		}
+
+		doc, err := c.get(ids[i])
+		if err != nil {
+			return err
+		}
+
+		more, err := fn(doc)
+		if err != nil || !more {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type memoryIndex struct {
+	mutex sync.RWMutex
+	ids   map[primitive.ObjectID]primitive.ObjectID
+}
+
+func (i *memoryIndex) set(key, id primitive.ObjectID) error {
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+
+	i.ids[key] = id
+	return nil
+}
+
+func (i *memoryIndex) lookup(key primitive.ObjectID) (primitive.ObjectID, error) {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+
+	id, ok := i.ids[key]
+	if !ok {
+		return primitive.NilObjectID, ErrNotFound
+	}
+	return id, nil
+}
@@ -11,18 +11,42 @@ const (
 	ResponsesCollection = "responses"
 )
 
+// Sources tell how a record was created.
+const (
+	SourceProxy  = "proxy"
+	SourceRepeat = "repeat"
+	SourceScan   = "scan"
+	SourceImport = "import"
+)
+
 type RequestData struct {
 	ID         primitive.ObjectID `bson:"_id,omitempty"`
 	Method     string             `bson:"method"`
 	Scheme     string             `bson:"scheme"`
 	Host       string             `bson:"host"`
+	SNI        string             `bson:"sni,omitempty"`
 	Path       string             `bson:"path"`
 	GetParams  bson.M             `bson:"get_params"`
 	Headers    bson.M             `bson:"headers"`
 	Cookies    map[string]string  `bson:"cookies"`
 	PostParams bson.M             `bson:"post_params,omitempty"`
-	Body       string             `bson:"body,omitempty"`
+	Body       []byte             `bson:"body,omitempty"`
 	Timestamp  primitive.DateTime `bson:"timestamp"`
+
+	// A truncated body holds only the first bytes; the complete body is
+	// kept in the BlobStore under BodyBlob.
+	BodySize  int64  `bson:"body_size,omitempty"`
+	Truncated bool   `bson:"truncated,omitempty"`
+	BodyBlob  string `bson:"body_blob,omitempty"`
+
+	// Raw is the request as it was read from the client.
+	Raw          []byte `bson:"raw,omitempty" json:"-"`
+	RawTruncated bool   `bson:"raw_truncated,omitempty"`
+
+	// Source is one of the Source constants. ParentID is the original request
+	// of repeated and scanned ones.
+	Source   string              `bson:"source,omitempty"`
+	ParentID *primitive.ObjectID `bson:"parent_id,omitempty" json:",omitempty"`
 }
 
 type ResponseData struct {
@@ -31,6 +55,34 @@ type ResponseData struct {
 	Code      int                `bson:"code"`
 	Message   string             `bson:"message"`
 	Headers   bson.M             `bson:"headers"`
-	Body      string             `bson:"body"`
+	Body      []byte             `bson:"body"`
 	Timestamp primitive.DateTime `bson:"timestamp"`
+
+	// Body holds the decoded content; these describe the bytes on the wire.
+	Encoding    string `bson:"encoding,omitempty"`
+	EncodedSize int64  `bson:"encoded_size"`
+	DecodedSize int64  `bson:"decoded_size"`
+	DecodeError string `bson:"decode_error,omitempty"`
+	Truncated   bool   `bson:"truncated,omitempty"`
+	BodyBlob    string `bson:"body_blob,omitempty"`
+
+	// Raw is the response as it was read from the server.
+	Raw          []byte `bson:"raw,omitempty" json:"-"`
+	RawTruncated bool   `bson:"raw_truncated,omitempty"`
+
+	Timings *Timings `bson:"timings,omitempty"`
+
+	// Source and ParentID are those of the request.
+	Source   string              `bson:"source,omitempty"`
+	ParentID *primitive.ObjectID `bson:"parent_id,omitempty" json:",omitempty"`
+}
+
+// Timings of an exchange in milliseconds, as in HAR. Connect is -1 if an open
+// connection was reused.
+type Timings struct {
+	Started primitive.DateTime `bson:"started"`
+	Connect float64            `bson:"connect"`
+	Send    float64            `bson:"send"`
+	Wait    float64            `bson:"wait"`
+	Receive float64            `bson:"receive"`
 }
@@ -0,0 +1,89 @@
+package repo
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// SaveOptions carries what is known about a message besides its parsed form.
+type SaveOptions struct {
+	Raw          []byte
+	RawTruncated bool
+	Timings      *Timings
+	// Timestamp replaces the time of saving, e.g. for imported records.
+	Timestamp time.Time
+	// Source defaults to SourceProxy.
+	Source string
+	// ParentID links a record to the request it was derived from.
+	ParentID string
+	// BodyLimit is the number of body bytes stored inline for bodies that
+	// were not captured by the caller, DefaultBodyLimit by default.
+	BodyLimit int64
+}
+
+type SaveOption func(*SaveOptions)
+
+// WithRaw stores the message as it was read from the wire.
+func WithRaw(raw []byte, truncated bool) SaveOption {
+	return func(o *SaveOptions) {
+		o.Raw = raw
+		o.RawTruncated = truncated
+	}
+}
+
+// WithTimings stores how long the phases of the exchange took, which only
+// applies to responses.
+func WithTimings(timings Timings) SaveOption {
+	return func(o *SaveOptions) {
+		o.Timings = &timings
+	}
+}
+
+// WithTimestamp stores when the message was originally captured.
+func WithTimestamp(timestamp time.Time) SaveOption {
+	return func(o *SaveOptions) {
+		o.Timestamp = timestamp
+	}
+}
+
+// WithSource tells how the record was created, see the Source constants.
+func WithSource(source string) SaveOption {
+	return func(o *SaveOptions) {
+		o.Source = source
+	}
+}
+
+// WithParent links a record to the stored request it was derived from.
+func WithParent(requestID string) SaveOption {
+	return func(o *SaveOptions) {
+		o.ParentID = requestID
+	}
+}
+
+// WithBodyLimit sets the inline limit of bodies that are not a Capture.
+func WithBodyLimit(limit int64) SaveOption {
+	return func(o *SaveOptions) {
+		o.BodyLimit = limit
+	}
+}
+
+func newSaveOptions(opts []SaveOption) *SaveOptions {
+	res := &SaveOptions{Source: SourceProxy, BodyLimit: DefaultBodyLimit}
+	for _, opt := range opts {
+		opt(res)
+	}
+	return res
+}
+
+func (o *SaveOptions) parentID() (*primitive.ObjectID, error) {
+	if o.ParentID == "" {
+		return nil, nil
+	}
+
+	id, err := primitive.ObjectIDFromHex(o.ParentID)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
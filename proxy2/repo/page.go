@@ -0,0 +1,120 @@
+package repo
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page selects a window of a listing, which is ordered from the newest to the
+// oldest record. Before and After are cursors returned by earlier listings and
+// exclude the record they point at. With After set, the page holds the records
+// closest to it rather than the newest ones.
+type Page struct {
+	Before string
+	After  string
+	Limit  int64
+}
+
+type RequestPage struct {
+	Items []*RequestData
+	// Next is the cursor of the following, older page, empty on the last page.
+	Next string
+}
+
+type ResponsePage struct {
+	Items []*ResponseData
+	// Next is the cursor of the following, older page, empty on the last page.
+	Next string
+}
+
+// scanRange bounds a scan by exclusive ids, zero ids are unbounded.
+type scanRange struct {
+	before    primitive.ObjectID
+	after     primitive.ObjectID
+	ascending bool
+}
+
+func (p *Page) scanRange() (scanRange, error) {
+	var r scanRange
+	var err error
+
+	if p.Before != "" {
+		if r.before, err = decodeCursor(p.Before); err != nil {
+			return r, err
+		}
+	}
+	if p.After != "" {
+		if r.after, err = decodeCursor(p.After); err != nil {
+			return r, err
+		}
+		r.ascending = true
+	}
+
+	return r, nil
+}
+
+// query restricts a Mongo query to the range.
+func (r *scanRange) query(query bson.M) bson.M {
+	id := bson.M{}
+	if !r.before.IsZero() {
+		id["$lt"] = r.before
+	}
+	if !r.after.IsZero() {
+		id["$gt"] = r.after
+	}
+	if len(id) != 0 {
+		query["_id"] = id
+	}
+	return query
+}
+
+func (r *scanRange) sort() bson.D {
+	if r.ascending {
+		return bson.D{{Key: "_id", Value: 1}}
+	}
+	return bson.D{{Key: "_id", Value: -1}}
+}
+
+// contains reports whether the raw id lies in the range.
+func (r *scanRange) contains(id []byte) bool {
+	return (r.before.IsZero() || bytes.Compare(id, r.before[:]) < 0) &&
+		(r.after.IsZero() || bytes.Compare(id, r.after[:]) > 0)
+}
+
+// nextCursor points past the oldest listed record. Pages that were read
+// towards newer records always have a following page, it holds the record
+// they started at.
+func (r *scanRange) nextCursor(oldest primitive.ObjectID, more bool) string {
+	if oldest.IsZero() || (!more && !r.ascending) {
+		return ""
+	}
+	return encodeCursor(oldest)
+}
+
+// Cursor points at the record with the id, e.g. to list the records after
+// it. The cursor of the zero id lies before every record.
+func Cursor(id primitive.ObjectID) string {
+	return encodeCursor(id)
+}
+
+func encodeCursor(id primitive.ObjectID) string {
+	return base64.RawURLEncoding.EncodeToString(id[:])
+}
+
+func decodeCursor(cursor string) (primitive.ObjectID, error) {
+	var id primitive.ObjectID
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(raw) != len(id) {
+		return id, ErrInvalidCursor
+	}
+
+	copy(id[:], raw)
+	return id, nil
+}
@@ -0,0 +1,163 @@
+package repo
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"http-proxy/pkg/http_utils"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var ErrNotFound = errors.New("not found")
+
+// newRequestData parses a request into the record kept by every backend.
+// Bodies that exceed the inline limit are put into blobs.
+func newRequestData(req *http.Request, blobs BlobStore, opts []SaveOption) (*RequestData, error) {
+	options := newSaveOptions(opts)
+
+	body, err := captureBody(&req.Body, options.BodyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &RequestData{
+		ID:        primitive.NewObjectID(),
+		Method:    req.Method,
+		Scheme:    req.URL.Scheme,
+		Host:      req.Host,
+		Path:      req.URL.Path,
+		GetParams: parseURLQuery(req.URL),
+		Headers:   parseHTTPHeaders(req.Header),
+		Cookies:   parseHTTPCookies(req.Cookies()),
+		Body:      body.Bytes(),
+		BodySize:  body.Size(),
+		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+	}
+
+	if req.TLS != nil {
+		data.SNI = req.TLS.ServerName
+	}
+
+	if body.Truncated() {
+		data.Truncated = true
+		data.BodyBlob, err = storeCapture(blobs, body)
+		if err != nil {
+			return nil, err
+		}
+	} else if postParams, err := parsePostParameters(req, body.Bytes()); err == nil && len(postParams) != 0 {
+		data.PostParams = postParams
+	}
+
+	data.Raw = options.Raw
+	data.RawTruncated = options.RawTruncated
+	if !options.Timestamp.IsZero() {
+		data.Timestamp = primitive.NewDateTimeFromTime(options.Timestamp)
+	}
+	data.Source = options.Source
+	if data.ParentID, err = options.parentID(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+func newResponseData(requestID string, resp *http.Response, blobs BlobStore, opts []SaveOption) (*ResponseData, error) {
+	requestObjectID, err := primitive.ObjectIDFromHex(requestID)
+	if err != nil {
+		return nil, err
+	}
+
+	options := newSaveOptions(opts)
+
+	body, err := captureBody(&resp.Body, options.BodyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	data := &ResponseData{
+		ID:          primitive.NewObjectID(),
+		RequestID:   requestObjectID,
+		Code:        resp.StatusCode,
+		Message:     statusMessage(resp.Status),
+		Headers:     convertToBSON(resp.Header),
+		Body:        body.Bytes(),
+		Timestamp:   primitive.NewDateTimeFromTime(time.Now()),
+		EncodedSize: body.Size(),
+		DecodedSize: body.Size(),
+	}
+
+	if body.Truncated() {
+		data.Truncated = true
+		data.BodyBlob, err = storeCapture(blobs, body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if encodings := utils.ContentEncodings(resp.Header); len(encodings) != 0 {
+		data.Encoding = strings.Join(encodings, ", ")
+
+		if body.Truncated() {
+			data.DecodeError = "body is truncated"
+			data.DecodedSize = 0
+		} else if decoded, err := utils.DecodeBody(body.Bytes(), encodings, body.limit); err != nil {
+			// The encoded body is kept, the decoded one may not even fit
+			// into a document.
+			data.DecodeError = err.Error()
+			data.DecodedSize = 0
+		} else {
+			data.Body = decoded
+			data.DecodedSize = int64(len(decoded))
+		}
+	}
+
+	data.Raw = options.Raw
+	data.RawTruncated = options.RawTruncated
+	if !options.Timestamp.IsZero() {
+		data.Timestamp = primitive.NewDateTimeFromTime(options.Timestamp)
+	}
+	data.Timings = options.Timings
+	data.Source = options.Source
+	if data.ParentID, err = options.parentID(); err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// encodeRequest rebuilds a stored request, reading an externally stored body
+// from blobs.
+func encodeRequest(data *RequestData, blobs BlobStore) (*http.Request, error) {
+	req, err := createHTTPRequest(data)
+	if err != nil {
+		return nil, err
+	}
+
+	if data.BodyBlob != "" {
+		req.Body, err = blobs.Open(data.BodyBlob)
+		if err != nil {
+			return nil, err
+		}
+		req.ContentLength = data.BodySize
+	}
+
+	return req, nil
+}
+
+func openResponseBody(data *ResponseData, blobs BlobStore) (io.ReadCloser, error) {
+	if data.BodyBlob != "" {
+		return blobs.Open(data.BodyBlob)
+	}
+	return io.NopCloser(bytes.NewReader(data.Body)), nil
+}
+
+// statusMessage strips the code from a status line like "200 OK".
+func statusMessage(status string) string {
+	_, message, _ := strings.Cut(status, " ")
+	return strings.TrimSpace(message)
+}
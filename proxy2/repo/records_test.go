@@ -0,0 +1,104 @@
+package repo
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestNewResponseDataDecoding(t *testing.T) {
+	plain := []byte("hello")
+	bomb := make([]byte, 64<<20)
+
+	tests := []struct {
+		name        string
+		body        []byte
+		wantBody    []byte
+		wantDecoded int64
+		wantError   bool
+	}{
+		{name: "decoded", body: gzipped(plain), wantBody: plain, wantDecoded: int64(len(plain))},
+		{name: "bomb", body: gzipped(bomb), wantError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{
+				StatusCode: http.StatusOK,
+				Status:     "200 OK",
+				Header:     http.Header{"Content-Encoding": {"gzip"}},
+				Body:       io.NopCloser(bytes.NewReader(tt.body)),
+			}
+
+			data, err := newResponseData(primitive.NewObjectID().Hex(), resp, nil, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantError {
+				if data.DecodeError == "" {
+					t.Error("no decode error")
+				}
+				if !bytes.Equal(data.Body, tt.body) {
+					t.Error("encoded body not kept")
+				}
+				return
+			}
+			if data.DecodeError != "" || !bytes.Equal(data.Body, tt.wantBody) || data.DecodedSize != tt.wantDecoded {
+				t.Errorf("body = %q, decoded size %d, error %q", data.Body, data.DecodedSize, data.DecodeError)
+			}
+		})
+	}
+}
+
+func TestNewRequestDataBodyLimit(t *testing.T) {
+	tests := []struct {
+		name          string
+		opts          []SaveOption
+		wantTruncated bool
+	}{
+		{name: "default limit"},
+		{name: "configured limit", opts: []SaveOption{WithBodyLimit(4)}, wantTruncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "http://example.com/", strings.NewReader("hello world"))
+			data, err := newRequestData(req, NewMemoryBlobStore(), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if data.Truncated != tt.wantTruncated || data.BodySize != 11 {
+				t.Errorf("truncated = %v, size %d", data.Truncated, data.BodySize)
+			}
+			if tt.wantTruncated && (string(data.Body) != "hell" || data.BodyBlob == "") {
+				t.Errorf("body = %q, blob %q", data.Body, data.BodyBlob)
+			}
+		})
+	}
+}
+
+func gzipped(body []byte) []byte {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write(body)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestRequestDataCookieOrder(t *testing.T) {
+	data := &RequestData{Cookies: map[string]string{"theme": "dark", "session": "abc", "lang": "en", "cart": "3"}}
+
+	for i := 0; i < 20; i++ {
+		if got := data.Header().Get("Cookie"); got != "cart=3; lang=en; session=abc; theme=dark" {
+			t.Fatalf("Cookie = %q", got)
+		}
+	}
+}
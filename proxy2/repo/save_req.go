@@ -1,10 +1,11 @@
 package repo
 
 import (
-	"bytes"
 	"context"
-	"io"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,51 +17,28 @@ const kRequests = "requests"
 
 type MongoRequestSaver struct {
 	requests *mongo.Collection
+	blobs    BlobStore
 }
 
-func NewMongoRequestSaver(conn *mongo.Client) RequestSaver {
+func NewMongoRequestSaver(conn *mongo.Client, blobs BlobStore) RequestSaver {
 	return &MongoRequestSaver{
 		requests: conn.Database(DatabaseName).Collection(kRequests),
+		blobs:    blobs,
 	}
 }
 
-func (s *MongoRequestSaver) Save(req *http.Request) (string, error) {
-	body, err := io.ReadAll(req.Body)
+func (s *MongoRequestSaver) Save(req *http.Request, opts ...SaveOption) (string, error) {
+	data, err := newRequestData(req, s.blobs, opts)
 	if err != nil {
 		return "", err
 	}
 
-	req.Body = io.NopCloser(bytes.NewReader(body))
-
-	value := bson.M{
-		"method":     req.Method,
-		"scheme":     req.URL.Scheme,
-		"host":       req.Host,
-		"path":       req.URL.Path,
-		"get_params": parseURLQuery(req.URL),
-		"headers":    parseHTTPHeaders(req.Header),
-		"cookies":    parseHTTPCookies(req.Cookies()),
-	}
-
-	postParams, err := parsePostParameters(req)
-	if err != nil {
-		return "", err
-	}
-	if len(postParams) != 0 {
-		value["post_params"] = postParams
-		req.Body = io.NopCloser(bytes.NewReader(body))
-	} else {
-		if req.Body != nil {
-			value["body"] = string(body)
-		}
-	}
-
-	res, err := s.requests.InsertOne(context.Background(), value)
+	_, err = s.requests.InsertOne(context.Background(), data)
 	if err != nil {
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	return data.ID.Hex(), nil
 }
 
 func (s *MongoRequestSaver) GetEncoded(id string) (*http.Request, error) {
@@ -69,7 +47,7 @@ func (s *MongoRequestSaver) GetEncoded(id string) (*http.Request, error) {
 		return nil, err
 	}
 
-	return createHTTPRequest(value)
+	return encodeRequest(value, s.blobs)
 }
 
 func (s *MongoRequestSaver) Get(id string) (*RequestData, error) {
@@ -83,27 +61,115 @@ func (s *MongoRequestSaver) Get(id string) (*RequestData, error) {
 
 	err = res.Decode(value)
 	if err != nil {
-		return nil, err
+		return nil, findError(err)
 	}
 
 	return value, nil
 }
 
-func (s *MongoRequestSaver) List(limit int64) ([]*RequestData, error) {
-	ctx := context.Background()
+// findError reports missing documents as ErrNotFound like the other backends.
+func findError(err error) error {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// kBodyScanLimit bounds the documents read by a body search, which cannot
+// use an index.
+const kBodyScanLimit = 10000
+
+// ErrScanLimit is returned by body searches that read kBodyScanLimit records
+// without filling the page.
+var ErrScanLimit = fmt.Errorf("body search stopped after %d records, narrow the filter", kBodyScanLimit)
 
-	opts := options.Find().SetLimit(limit).SetSort(bson.D{{Key: "_id", Value: -1}})
-	cursor, err := s.requests.Find(ctx, bson.D{}, opts)
+// bodyQuery narrows the query to the ids of the first limit documents with
+// a matching body. Bodies are stored as binary, which Mongo cannot search, so
+// they are matched here while reading nothing but the ids and the bodies.
+func bodyQuery(ctx context.Context, c *mongo.Collection, filter Filter, r scanRange, query bson.M, limit int64) (bson.M, error) {
+	if filter.Body == "" {
+		return query, nil
+	}
+
+	// One more document tells whether the scan reached the end.
+	opts := options.Find().SetSort(r.sort()).SetProjection(bson.M{"body": 1}).SetLimit(kBodyScanLimit + 1)
+	cursor, err := c.Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
+	defer cursor.Close(ctx)
 
-	res := make([]*RequestData, 0, limit/2)
+	ids := bson.A{}
+	scanned := 0
+	for int64(len(ids)) < limit && cursor.Next(ctx) {
+		if scanned == kBodyScanLimit {
+			return nil, ErrScanLimit
+		}
+		scanned++
 
-	err = cursor.All(ctx, &res)
+		var doc struct {
+			ID   primitive.ObjectID `bson:"_id"`
+			Body []byte             `bson:"body"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		if filter.matchBody(doc.Body) {
+			ids = append(ids, doc.ID)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	return bson.M{"_id": bson.M{"$in": ids}}, nil
+}
+
+func (s *MongoRequestSaver) List(filter Filter, page Page) (*RequestPage, error) {
+	r, err := page.scanRange()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := context.Background()
+
+	query, err := bodyQuery(ctx, s.requests, filter, r, r.query(filter.requestQuery()), page.Limit+1)
 	if err != nil {
 		return nil, err
 	}
 
+	// The extra document tells whether there is a following page.
+	opts := options.Find().SetSort(r.sort()).SetLimit(page.Limit + 1)
+	cursor, err := s.requests.Find(ctx, query, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	res := &RequestPage{Items: make([]*RequestData, 0, page.Limit/2)}
+	more := false
+
+	for cursor.Next(ctx) {
+		value := &RequestData{}
+		if err := cursor.Decode(value); err != nil {
+			return nil, err
+		}
+		if int64(len(res.Items)) == page.Limit {
+			more = true
+			break
+		}
+		res.Items = append(res.Items, value)
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	if r.ascending {
+		slices.Reverse(res.Items)
+	}
+	if len(res.Items) != 0 {
+		res.Next = r.nextCursor(res.Items[len(res.Items)-1].ID, more)
+	}
+
 	return res, nil
 }
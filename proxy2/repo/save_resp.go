@@ -1,11 +1,10 @@
 package repo
 
 import (
-	"bytes"
 	"context"
 	"io"
 	"net/http"
-	"strings"
+	"slices"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -16,41 +15,40 @@ import (
 
 type MongoResponseSaver struct {
 	collection *mongo.Collection
+	blobs      BlobStore
 }
 
-func NewMongoResponseSaver(client *mongo.Client) ResponseSaver {
-	return &MongoResponseSaver{
-		collection: client.Database(DatabaseName).Collection(ResponsesCollection),
-	}
-}
+// NewMongoResponseSaver creates the index used to find the response of a
+// request, unless it exists.
+func NewMongoResponseSaver(client *mongo.Client, blobs BlobStore) (ResponseSaver, error) {
+	collection := client.Database(DatabaseName).Collection(ResponsesCollection)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
 
-func (s *MongoResponseSaver) Save(requestID string, resp *http.Response) (string, error) {
-	requestObjectID, err := primitive.ObjectIDFromHex(requestID)
+	_, err := collection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "request_id", Value: 1}}})
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	body, err := io.ReadAll(resp.Body)
+	return &MongoResponseSaver{
+		collection: collection,
+		blobs:      blobs,
+	}, nil
+}
+
+func (s *MongoResponseSaver) Save(requestID string, resp *http.Response, opts ...SaveOption) (string, error) {
+	data, err := newResponseData(requestID, resp, s.blobs, opts)
 	if err != nil {
 		return "", err
 	}
-	resp.Body = io.NopCloser(bytes.NewReader(body))
-
-	doc := bson.M{
-		"code":       resp.StatusCode,
-		"message":    strings.TrimSpace(resp.Status[strings.Index(resp.Status, " "):]),
-		"headers":    convertToBSON(resp.Header),
-		"request_id": requestObjectID,
-		"body":       string(body),
-		"timestamp":  primitive.NewDateTimeFromTime(time.Now()),
-	}
 
-	res, err := s.collection.InsertOne(context.Background(), doc)
+	_, err = s.collection.InsertOne(context.Background(), data)
 	if err != nil {
 		return "", err
 	}
 
-	return res.InsertedID.(primitive.ObjectID).Hex(), nil
+	return data.ID.Hex(), nil
 }
 
 func (s *MongoResponseSaver) Get(id string) (*ResponseData, error) {
@@ -63,8 +61,20 @@ func (s *MongoResponseSaver) Get(id string) (*ResponseData, error) {
 	err = s.collection.
 		FindOne(context.Background(), bson.M{"_id": objectID}).
 		Decode(&result)
+	if err != nil {
+		return nil, findError(err)
+	}
+
+	return &result, nil
+}
+
+func (s *MongoResponseSaver) OpenBody(id string) (io.ReadCloser, error) {
+	resp, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
 
-	return &result, err
+	return openResponseBody(resp, s.blobs)
 }
 
 func (s *MongoResponseSaver) GetByRequest(requestID string) (*ResponseData, error) {
@@ -77,26 +87,57 @@ func (s *MongoResponseSaver) GetByRequest(requestID string) (*ResponseData, erro
 	err = s.collection.
 		FindOne(context.Background(), bson.M{"request_id": objectID}).
 		Decode(&result)
+	if err != nil {
+		return nil, findError(err)
+	}
 
-	return &result, err
+	return &result, nil
 }
 
-func (s *MongoResponseSaver) List(limit int64) ([]*ResponseData, error) {
-	opts := options.Find().
-		SetLimit(limit).
-		SetSort(bson.M{"_id": -1})
+func (s *MongoResponseSaver) List(filter Filter, page Page) (*ResponsePage, error) {
+	r, err := page.scanRange()
+	if err != nil {
+		return nil, err
+	}
 
 	ctx := context.Background()
-	cursor, err := s.collection.Find(ctx, bson.M{}, opts)
+
+	query, err := bodyQuery(ctx, s.collection, filter, r, r.query(filter.responseQuery()), page.Limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := options.Find().SetSort(r.sort()).SetLimit(page.Limit + 1)
+	cursor, err := s.collection.Find(ctx, query, opts)
 	if err != nil {
 		return nil, err
 	}
 	defer cursor.Close(ctx)
 
-	var results []*ResponseData
-	if err := cursor.All(ctx, &results); err != nil {
+	res := &ResponsePage{Items: make([]*ResponseData, 0, page.Limit/2)}
+	more := false
+
+	for cursor.Next(ctx) {
+		value := &ResponseData{}
+		if err := cursor.Decode(value); err != nil {
+			return nil, err
+		}
+		if int64(len(res.Items)) == page.Limit {
+			more = true
+			break
+		}
+		res.Items = append(res.Items, value)
+	}
+	if err := cursor.Err(); err != nil {
 		return nil, err
 	}
 
-	return results, nil
+	if r.ascending {
+		slices.Reverse(res.Items)
+	}
+	if len(res.Items) != 0 {
+		res.Next = r.nextCursor(res.Items[len(res.Items)-1].ID, more)
+	}
+
+	return res, nil
 }
@@ -1,9 +1,12 @@
 package repo
 
 import (
+	"bytes"
 	"io"
+	"maps"
 	"net/http"
 	"net/url"
+	"slices"
 	"strings"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -23,16 +26,18 @@ func createHTTPRequest(data *RequestData) (*http.Request, error) {
 	req.Header = convertFromBSON(data.Headers)
 	addCookies(req, data.Cookies)
 	req.URL.RawQuery = encodeQueryParams(convertFromBSON(data.GetParams))
-	req.Body = createRequestBody(req, data)
+	req.Body, req.ContentLength = createRequestBody(data)
 
 	return req, nil
 }
 
+// addCookies adds the cookies sorted by name, so that a rebuilt request is
+// the same every time.
 func addCookies(req *http.Request, cookies map[string]string) {
-	for name, value := range cookies {
+	for _, name := range slices.Sorted(maps.Keys(cookies)) {
 		req.AddCookie(&http.Cookie{
 			Name:  name,
-			Value: value,
+			Value: cookies[name],
 		})
 	}
 }
@@ -41,12 +46,18 @@ func encodeQueryParams(values map[string][]string) string {
 	return url.Values(values).Encode()
 }
 
-func createRequestBody(req *http.Request, data *RequestData) io.ReadCloser {
-	if req.Header.Get("Content-Type") == "application/x-www-form-urlencoded" {
-		params := convertFromBSON(data.PostParams)
-		return io.NopCloser(strings.NewReader(url.Values(params).Encode()))
+// createRequestBody returns the stored body bytes. Records without a body
+// but with parsed form parameters are re-encoded from the parameters.
+func createRequestBody(data *RequestData) (io.ReadCloser, int64) {
+	body := data.Body
+	if len(body) == 0 && len(data.PostParams) != 0 {
+		body = []byte(url.Values(convertFromBSON(data.PostParams)).Encode())
 	}
-	return io.NopCloser(strings.NewReader(data.Body))
+
+	if len(body) == 0 {
+		return http.NoBody, 0
+	}
+	return io.NopCloser(bytes.NewReader(body)), int64(len(body))
 }
 
 func parseHTTPHeaders(headers http.Header) bson.M {
@@ -68,14 +79,20 @@ func parseHTTPCookies(cookies []*http.Cookie) map[string]string {
 	return result
 }
 
-func parsePostParameters(req *http.Request) (bson.M, error) {
-	if req.Body == nil {
+func parsePostParameters(req *http.Request, body []byte) (bson.M, error) {
+	if len(body) == 0 {
 		return nil, nil
 	}
 
-	if err := req.ParseForm(); err != nil {
+	form := &http.Request{
+		Method:        req.Method,
+		Header:        req.Header,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+	if err := form.ParseForm(); err != nil {
 		return nil, err
 	}
 
-	return convertToBSON(req.PostForm), nil
+	return convertToBSON(form.PostForm), nil
 }
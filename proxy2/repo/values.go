@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// Header returns the request headers. Cookies are stored separately and
+// are added back as a single Cookie header.
+func (r *RequestData) Header() http.Header {
+	req := &http.Request{Header: convertFromBSON(r.Headers)}
+	addCookies(req, r.Cookies)
+	return req.Header
+}
+
+func (r *RequestData) Query() url.Values {
+	return url.Values(convertFromBSON(r.GetParams))
+}
+
+// Form returns the parsed form parameters of the body.
+func (r *RequestData) Form() url.Values {
+	return url.Values(convertFromBSON(r.PostParams))
+}
+
+func (r *ResponseData) Header() http.Header {
+	return http.Header(convertFromBSON(r.Headers))
+}
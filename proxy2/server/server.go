@@ -5,16 +5,14 @@ import (
 	"net"
 )
 
-func Run(port int, handler func(net.Conn) error) {
-	listener, err := net.ListenTCP("tcp", &net.TCPAddr{
-		Port: port,
-	})
+func Run(addr string, handler func(net.Conn) error) {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	fmt.Printf("Listening at port %d...\n", port)
+	fmt.Printf("Listening at %s...\n", addr)
 
 	for {
 		conn, err := listener.Accept()